@@ -0,0 +1,254 @@
+// Command pmongo-gen generates field path constants for the documents of a package, i.e. the structs with a
+// CollectionName method, so that queries and updates do not repeat bson keys as string literals:
+//
+//	//go:generate go run github.com/phil-inc/pmongo/cmd/pmongo-gen -type Order,Customer
+//
+// Every exported field gets a constant named after the type and the Go field path, holding the bson path. The
+// constants of a document have their own type, so that they do not mix with plain strings or the paths of other
+// documents in signatures:
+//
+//	type OrderField string
+//
+//	const (
+//		OrderID          OrderField = "_id"
+//		OrderStatus      OrderField = "status"
+//		OrderAddressCity OrderField = "address.city"
+//		OrderItemsSku    OrderField = "items.sku"
+//	)
+//
+// core.Where, core.Asc, core.Desc, the positional path helpers and the updates created with core.NewUpdateOf take
+// them as is, e.g. core.NewUpdateOf[OrderField]().Set(OrderStatus, "shipped").
+//
+// Keys follow the driver rules: the bson tag name, or the lower cased field name without one. Embedded structs
+// tagged inline, such as core.BaseData, contribute their fields at the top level; other embedded structs are
+// nested documents keyed by their lower cased type name.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the package holding the documents")
+	output := flag.String("output", "pmongo_fields.go", "file to write, relative to -dir unless absolute")
+	typeNames := flag.String("type", "", "comma separated documents to generate constants for, all of them when empty")
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("pmongo-gen: ")
+
+	var only []string
+	if *typeNames != "" {
+		only = strings.Split(*typeNames, ",")
+	}
+	src, err := generate(*dir, *output, only)
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := *output
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(*dir, path)
+	}
+	if err := os.WriteFile(path, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// fieldPath is a generated constant: its name and the bson path it holds.
+type fieldPath struct {
+	name string
+	path string
+}
+
+// generate type checks the package in dir, leaving out the output file, and returns the source of the constants
+// for its documents, restricted to the given type names when there are any.
+func generate(dir, output string, only []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != filepath.Base(output)
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	var files []*ast.File
+	var pkgName string
+	for name, pkg := range pkgs {
+		pkgName = name
+		for _, file := range pkg.Files {
+			files = append(files, file)
+		}
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check(pkgName, fset, files, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	names := only
+	if len(names) == 0 {
+		names = pkg.Scope().Names()
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by pmongo-gen. DO NOT EDIT.\n\npackage %s\n", pkgName)
+	seen := make(map[string]string)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			if len(only) > 0 {
+				return nil, fmt.Errorf("type %s not found in package %s", name, pkgName)
+			}
+			continue
+		}
+		st, ok := obj.Type().Underlying().(*types.Struct)
+		if !ok || !isDocument(obj.Type()) {
+			if len(only) > 0 {
+				return nil, fmt.Errorf("type %s is not a document: it needs a CollectionName method", name)
+			}
+			continue
+		}
+
+		var paths []fieldPath
+		collect(st, name, "", map[*types.Struct]bool{st: true}, &paths)
+		if len(paths) == 0 {
+			continue
+		}
+		typeName := name + "Field"
+		if pkg.Scope().Lookup(typeName) != nil {
+			return nil, fmt.Errorf("type %s is already declared in package %s", typeName, pkgName)
+		}
+		seen[typeName] = "type " + typeName
+		fmt.Fprintf(&buf, "\n// %s is a field path of %s.\ntype %s string\n", typeName, name, typeName)
+		fmt.Fprintf(&buf, "\n// Field paths of %s.\nconst (\n", name)
+		for _, p := range paths {
+			if previous, ok := seen[p.name]; ok {
+				return nil, fmt.Errorf("constant %s is generated for both %q and %q", p.name, previous, p.path)
+			}
+			seen[p.name] = p.path
+			fmt.Fprintf(&buf, "\t%s %s = %q\n", p.name, typeName, p.path)
+		}
+		buf.WriteString(")\n")
+	}
+	return format.Source(buf.Bytes())
+}
+
+// isDocument reports whether the type, or a pointer to it, has a CollectionName() string method.
+func isDocument(t types.Type) bool {
+	for _, typ := range []types.Type{t, types.NewPointer(t)} {
+		sel := types.NewMethodSet(typ).Lookup(nil, "CollectionName")
+		if sel == nil {
+			continue
+		}
+		sig := sel.Type().(*types.Signature)
+		if sig.Params().Len() == 0 && sig.Results().Len() == 1 && types.Identical(sig.Results().At(0).Type(), types.Typ[types.String]) {
+			return true
+		}
+	}
+	return false
+}
+
+// collect appends the paths of the fields of the struct, prefixing constant names with name and bson paths with
+// prefix. visiting guards against recursive types.
+func collect(st *types.Struct, name, prefix string, visiting map[*types.Struct]bool, paths *[]fieldPath) {
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Exported() {
+			continue
+		}
+		key, inline, skip := parseTag(st.Tag(i))
+		if skip {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(field.Name())
+		}
+
+		nested := nestedStruct(field.Type())
+		if inline {
+			// Inline maps hold arbitrary keys, there is no path to generate for them.
+			if nested != nil && !visiting[nested] {
+				visiting[nested] = true
+				collect(nested, name, prefix, visiting, paths)
+				delete(visiting, nested)
+			}
+			continue
+		}
+
+		*paths = append(*paths, fieldPath{name: name + field.Name(), path: prefix + key})
+		if nested != nil && !visiting[nested] {
+			visiting[nested] = true
+			collect(nested, name+field.Name(), prefix+key+".", visiting, paths)
+			delete(visiting, nested)
+		}
+	}
+}
+
+// parseTag returns the key and inline flag of a bson struct tag, and whether the field is skipped.
+func parseTag(tag string) (key string, inline, skip bool) {
+	value, ok := reflect.StructTag(tag).Lookup("bson")
+	if !ok {
+		return "", false, false
+	}
+	if value == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(value, ",")
+	for _, option := range parts[1:] {
+		if option == "inline" {
+			inline = true
+		}
+	}
+	return parts[0], inline, false
+}
+
+// nestedStruct returns the struct a field holds as a nested document, following pointers, slices and arrays, or
+// nil when its values are not documents: basic types, maps, and types from the driver or the standard library
+// such as primitive.ObjectID and time.Time.
+func nestedStruct(t types.Type) *types.Struct {
+	for {
+		switch typ := t.(type) {
+		case *types.Pointer:
+			t = typ.Elem()
+		case *types.Slice:
+			t = typ.Elem()
+		case *types.Array:
+			t = typ.Elem()
+		case *types.Named:
+			if pkg := typ.Obj().Pkg(); pkg != nil && isOpaquePackage(pkg.Path()) {
+				return nil
+			}
+			t = typ.Underlying()
+		case *types.Struct:
+			for i := 0; i < typ.NumFields(); i++ {
+				if typ.Field(i).Exported() {
+					return typ
+				}
+			}
+			return nil
+		default:
+			return nil
+		}
+	}
+}
+
+// isOpaquePackage reports whether the types of the package are stored as values rather than documents.
+func isOpaquePackage(path string) bool {
+	return path == "time" || path == "math/big" || strings.HasPrefix(path, "go.mongodb.org/mongo-driver/")
+}
@@ -0,0 +1,57 @@
+// Command pmongo runs maintenance tasks on the databases of a service. Its migrate subcommand applies, rolls back
+// and lists the migrations registered with the migrations package:
+//
+//	pmongo migrate -config db.yaml status
+//	pmongo migrate -db main -dry-run up
+//	pmongo migrate -db main down 1
+//
+// Migrations are Go code, so they must be linked into the binary: services build their own pmongo from a main
+// package importing their migrations for their side effects, and calling migrations.Command like this one does.
+//
+//	import _ "example.com/service/migrations"
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/phil-inc/pmongo/pkg/migrations"
+)
+
+const usage = `Usage: pmongo <command> [arguments]
+
+Commands:
+  migrate   apply, roll back or list the migrations, see pmongo migrate -h
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "migrate":
+		err = migrations.Command(ctx, os.Args[2:], os.Stdout)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "pmongo: unknown command %q\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pmongo: %s\n", err)
+		if errors.Is(err, migrations.ErrUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Pipeline builds an aggregation pipeline, to run with Aggregate, AggregateEach or DBConnection.AggregateCursor:
+//
+//	pipeline := core.NewPipeline().
+//		Match(core.Where("status").Eq("shipped")).
+//		Group("$customerId", core.Q{"total": core.Q{"$sum": "$amount"}}).
+//		Sort(core.Desc("total")).
+//		Limit(10)
+//
+// Stages the builder has no method for are added with Stage.
+type Pipeline struct {
+	stages []interface{}
+}
+
+// AggregateOptions are the options of an aggregation. AllowDiskUse lets stages exceeding the memory limit write
+// temporary files, MaxTime bounds the execution time on the server and BatchSize sets the number of documents
+// per batch of the cursor. Zero values leave the server defaults.
+type AggregateOptions struct {
+	AllowDiskUse bool
+	MaxTime      time.Duration
+	BatchSize    int32
+}
+
+// NewPipeline creates an empty pipeline.
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// Stage appends a stage, e.g. Stage(core.Q{"$sample": core.Q{"size": 5}}). Use a bson.D for stages whose
+// fields are ordered.
+func (p *Pipeline) Stage(stage interface{}) *Pipeline {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+// Match filters the documents with the query.
+func (p *Pipeline) Match(query Q) *Pipeline {
+	return p.Stage(Q{"$match": query})
+}
+
+// Group groups the documents by the id expression, e.g. "$customerId", computing the accumulators of each group,
+// e.g. Q{"total": Q{"$sum": "$amount"}}.
+func (p *Pipeline) Group(id interface{}, accumulators Q) *Pipeline {
+	group := Q{"_id": id}
+	for field, accumulator := range accumulators {
+		group[field] = accumulator
+	}
+	return p.Stage(Q{"$group": group})
+}
+
+// Project reshapes the documents with the projection.
+func (p *Pipeline) Project(projection Q) *Pipeline {
+	return p.Stage(Q{"$project": projection})
+}
+
+// AddFields adds the computed fields to the documents.
+func (p *Pipeline) AddFields(fields Q) *Pipeline {
+	return p.Stage(Q{"$addFields": fields})
+}
+
+// Lookup joins the documents of the from collection whose foreignField equals localField, as an array in the
+// as field.
+func (p *Pipeline) Lookup(from, localField, foreignField, as string) *Pipeline {
+	return p.Stage(Q{"$lookup": Q{"from": from, "localField": localField, "foreignField": foreignField, "as": as}})
+}
+
+// Unwind outputs a document for each element of the array at path, e.g. "$items". Documents where the array is
+// missing or empty are kept when preserveEmpty is set.
+func (p *Pipeline) Unwind(path string, preserveEmpty bool) *Pipeline {
+	if !preserveEmpty {
+		return p.Stage(Q{"$unwind": path})
+	}
+	return p.Stage(Q{"$unwind": Q{"path": path, "preserveNullAndEmptyArrays": true}})
+}
+
+// Sort sorts the documents by the fields, in order.
+func (p *Pipeline) Sort(fields ...SortField) *Pipeline {
+	return p.Stage(bson.D{{Key: "$sort", Value: sortD(fields, false)}})
+}
+
+// Skip skips the first n documents.
+func (p *Pipeline) Skip(n int64) *Pipeline {
+	return p.Stage(Q{"$skip": n})
+}
+
+// Limit keeps the first n documents.
+func (p *Pipeline) Limit(n int64) *Pipeline {
+	return p.Stage(Q{"$limit": n})
+}
+
+// Count outputs a single document holding the number of documents in field.
+func (p *Pipeline) Count(field string) *Pipeline {
+	return p.Stage(Q{"$count": field})
+}
+
+// Facet runs each sub-pipeline on the same documents, outputting a single document with their results under
+// their names.
+func (p *Pipeline) Facet(facets map[string]*Pipeline) *Pipeline {
+	facet := make(Q, len(facets))
+	for name, pipeline := range facets {
+		facet[name] = pipeline.Stages()
+	}
+	return p.Stage(Q{"$facet": facet})
+}
+
+// Bucket groups the documents into buckets by the groupBy expression, with the given ascending boundaries.
+// Documents outside the boundaries go to the defaultBucket, which can be nil when there are none. output holds
+// the accumulators of each bucket, nil to only count the documents.
+func (p *Pipeline) Bucket(groupBy interface{}, boundaries []interface{}, defaultBucket interface{}, output Q) *Pipeline {
+	bucket := Q{"groupBy": groupBy, "boundaries": boundaries}
+	if defaultBucket != nil {
+		bucket["default"] = defaultBucket
+	}
+	if output != nil {
+		bucket["output"] = output
+	}
+	return p.Stage(Q{"$bucket": bucket})
+}
+
+// Merge writes the documents to the into collection, matching existing documents on the on fields, _id when
+// none are given, replacing matches and inserting the others. Use Stage for other whenMatched behaviours.
+func (p *Pipeline) Merge(into string, on ...string) *Pipeline {
+	merge := Q{"into": into}
+	if len(on) > 0 {
+		merge["on"] = on
+	}
+	return p.Stage(Q{"$merge": merge})
+}
+
+// Stages returns the stages of the pipeline.
+func (p *Pipeline) Stages() []interface{} {
+	if p == nil {
+		return []interface{}{}
+	}
+	return append([]interface{}{}, p.stages...)
+}
+
+// options returns the aggregate options, leaving zero values unset.
+func (a AggregateOptions) options() *options.AggregateOptions {
+	opts := options.Aggregate()
+	if a.AllowDiskUse {
+		opts.SetAllowDiskUse(true)
+	}
+	if a.MaxTime > 0 {
+		opts.SetMaxTime(a.MaxTime)
+	}
+	if a.BatchSize > 0 {
+		opts.SetBatchSize(a.BatchSize)
+	}
+	return opts
+}
+
+// AggregateCursor runs the pipeline on the collection and returns a cursor over its results.
+func (s *DBConnection) AggregateCursor(ctx context.Context, collectionName string, pipeline *Pipeline, opts AggregateOptions) (*mongo.Cursor, error) {
+	ctx = s.context(ctx)
+	return s.Collection(collectionName).Aggregate(ctx, pipeline.Stages(), opts.options())
+}
+
+// Aggregate runs the pipeline on the collection and returns its results decoded into T, which can be any type
+// the documents output by the pipeline decode into, e.g. a struct or bson.M.
+func Aggregate[T any](ctx context.Context, conn *DBConnection, collectionName string, pipeline *Pipeline, opts AggregateOptions) ([]T, error) {
+	results := make([]T, 0)
+	err := AggregateEach(ctx, conn, collectionName, pipeline, opts, func(result T) error {
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// AggregateIterate runs the pipeline on the collection and returns an iterator over its results.
+func AggregateIterate[T any](ctx context.Context, conn *DBConnection, collectionName string, pipeline *Pipeline, opts AggregateOptions) (*Iterator[T], error) {
+	cursor, err := conn.AggregateCursor(ctx, collectionName, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewIterator[T](cursor), nil
+}
+
+// AggregateEach runs the pipeline on the collection and calls fn with every result, decoding one result at a
+// time. It stops at the first error returned by fn, which it returns.
+func AggregateEach[T any](ctx context.Context, conn *DBConnection, collectionName string, pipeline *Pipeline, opts AggregateOptions, fn func(T) error) error {
+	it, err := AggregateIterate[T](ctx, conn, collectionName, pipeline, opts)
+	if err != nil {
+		return err
+	}
+	return each(ctx, it, fn)
+}
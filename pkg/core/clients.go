@@ -0,0 +1,144 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// sharedClient is a client, and its connection pool, shared by all the databases whose configs point at the
+// same cluster with the same client options. refs counts those databases. The client is created unconnected and
+// connected by the first database that needs it, see Db.connect.
+type sharedClient struct {
+	key    string
+	client *mongo.Client
+	ops    *opTracker
+	refs   int
+
+	connectMu sync.Mutex
+	connected bool
+}
+
+// newSharedClient creates an unconnected client for the given config.
+func newSharedClient(config DBConfig) (*sharedClient, error) {
+	clientOptions, err := config.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	ops := &opTracker{}
+	client, err := mongo.NewClient(clientOptions.SetMonitor(ops.monitor()))
+	if err != nil {
+		return nil, err
+	}
+	return &sharedClient{key: config.clientKey(), client: client, ops: ops}, nil
+}
+
+// connect connects the client unless it already is.
+func (c *sharedClient) connect(ctx context.Context) error {
+	c.connectMu.Lock()
+	defer c.connectMu.Unlock()
+	if c.connected {
+		return nil
+	}
+	if err := c.client.Connect(ctx); err != nil {
+		return err
+	}
+	c.connected = true
+	return nil
+}
+
+// isConnected reports whether the client has been connected.
+func (c *sharedClient) isConnected() bool {
+	c.connectMu.Lock()
+	defer c.connectMu.Unlock()
+	return c.connected
+}
+
+// acquireClient returns the client shared by databases with the same client key as the given config, creating
+// a new one when there is none yet, and takes a reference on it.
+func (r *Registry) acquireClient(config DBConfig) (*sharedClient, error) {
+	key := config.clientKey()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if shared, ok := r.clients[key]; ok {
+		shared.refs++
+		return shared, nil
+	}
+
+	shared, err := newSharedClient(config)
+	if err != nil {
+		return nil, err
+	}
+	shared.refs = 1
+	r.clients[key] = shared
+	return shared, nil
+}
+
+// releaseLocked drops the reference the database holds on its client and reports whether it was the last
+// one, in which case the client should be disconnected. Databases registered by hand own their client, so
+// for them it always reports true. r.mu must be held.
+func (r *Registry) releaseLocked(db Db) bool {
+	if db.shared == nil {
+		return true
+	}
+	db.shared.refs--
+	if db.shared.refs > 0 {
+		return false
+	}
+	if r.clients[db.shared.key] == db.shared {
+		delete(r.clients, db.shared.key)
+	}
+	return true
+}
+
+// clientKey identifies the client a config can share: the normalized connection string plus every client level
+// option. Database level settings such as Alias, DBName and the read preference are left out.
+func (c DBConfig) clientKey() string {
+	return fmt.Sprintf("%s|app=%s|pool=%d-%d|idle=%s|timeouts=%s,%s,%s|compressors=%s|retry=%s,%s|tls=%t,%s,%s",
+		normalizeURI(c.HostURL), c.AppName, c.MinPoolSize, c.MaxPoolSize, c.MaxConnIdleTime,
+		c.connectTimeout(), c.ServerSelectionTimeout, c.SocketTimeout, strings.Join(c.Compressors, ","),
+		boolPtrString(c.RetryWrites), boolPtrString(c.RetryReads), c.TLS, c.TLSCAFile, c.TLSCertificateKeyFile)
+}
+
+// normalizeURI normalizes a connection string so that equivalent ones compare equal: scheme and hosts are
+// lower cased, hosts and query options are sorted. Strings it cannot make sense of are returned as is.
+func normalizeURI(uri string) string {
+	scheme, rest, ok := strings.Cut(strings.TrimSpace(uri), "://")
+	if !ok {
+		return uri
+	}
+	authority, path := rest, ""
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		authority, path = rest[:i], rest[i:]
+	}
+	userInfo := ""
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		userInfo, authority = authority[:i+1], authority[i+1:]
+	}
+	hosts := strings.Split(strings.ToLower(authority), ",")
+	sort.Strings(hosts)
+
+	dbPath, rawQuery, _ := strings.Cut(strings.TrimPrefix(path, "/"), "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return uri
+	}
+	normalized := make(url.Values, len(query))
+	for key, values := range query {
+		normalized[strings.ToLower(key)] = values
+	}
+	return fmt.Sprintf("%s://%s%s/%s?%s", strings.ToLower(scheme), userInfo, strings.Join(hosts, ","), dbPath, normalized.Encode())
+}
+
+func boolPtrString(b *bool) string {
+	if b == nil {
+		return "default"
+	}
+	return fmt.Sprint(*b)
+}
@@ -0,0 +1,265 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultConnectTimeout is used when DBConfig.ConnectTimeout is not set.
+const defaultConnectTimeout = 10 * time.Second
+
+// Supported wire compressors for DBConfig.Compressors.
+const (
+	CompressorZstd   = "zstd"
+	CompressorSnappy = "snappy"
+	CompressorZlib   = "zlib"
+)
+
+// DBConfig represents the configuration parameters needed for a MongoDB connection. Only HostURL and DBName
+// are required; zero values leave the setting to the connection string or the driver default.
+type DBConfig struct {
+	HostURL, DBName string
+
+	// Alias is the name the database is registered and looked up under, e.g. with ConnectionByName. It defaults
+	// to DBName and lets databases with the same name on different clusters be registered side by side; DBName
+	// is only used to open the database on the cluster.
+	Alias string
+
+	// Mode is the read preference of the connections returned for this database. DefaultMode, the zero value,
+	// keeps the one of the connection string, primary when it sets none. TagSets and MaxStaleness refine it;
+	// see ReadPref.
+	Mode         Mode
+	TagSets      []map[string]string
+	MaxStaleness time.Duration
+
+	// AppName is sent to the server during the handshake and shows up in its logs and currentOp output.
+	AppName string
+
+	// MaxPoolSize and MinPoolSize bound the number of connections kept per server.
+	MaxPoolSize, MinPoolSize uint64
+	// MaxConnIdleTime is how long a pooled connection can stay idle before it is closed.
+	MaxConnIdleTime time.Duration
+
+	// ConnectTimeout bounds establishing a connection and each connect attempt in Setup. Defaults to 10s.
+	ConnectTimeout time.Duration
+	// ServerSelectionTimeout bounds how long an operation waits for a suitable server.
+	ServerSelectionTimeout time.Duration
+	// SocketTimeout bounds socket reads and writes.
+	SocketTimeout time.Duration
+
+	// Compressors lists the wire compressors to negotiate, in order of preference: zstd, snappy or zlib.
+	Compressors []string
+
+	// RetryWrites and RetryReads override the driver defaults (both enabled) when set.
+	RetryWrites, RetryReads *bool
+
+	// TLS enables TLS using the system roots. It is implied when TLSCAFile or TLSCertificateKeyFile is set.
+	TLS bool
+	// TLSCAFile is a PEM file with the certificate authorities used to verify the server.
+	TLSCAFile string
+	// TLSCertificateKeyFile is a PEM file with the client certificate and its private key.
+	TLSCertificateKeyFile string
+
+	// VerifyOnSetup makes Setup ping the cluster and fail when it is unreachable. Otherwise Setup returns once the
+	// client is created and the driver connects in the background, so operations fail until the cluster is up.
+	VerifyOnSetup bool
+
+	// ConnectRetries is how many more times Setup pings the cluster with VerifyOnSetup after a failed attempt: 3
+	// by default, negative for none. Without VerifyOnSetup, nothing is retried as Setup does not reach the cluster. Attempts are spaced by RetryBackoff, doubled after
+	// every attempt up to MaxRetryBackoff, with jitter. RetryBackoff defaults to 500ms and MaxRetryBackoff to 30s.
+	ConnectRetries                int
+	RetryBackoff, MaxRetryBackoff time.Duration
+
+	// Lazy makes Setup register the database without connecting; the client connects on first use, so services
+	// can start while the database is temporarily down.
+	Lazy bool
+}
+
+// Validate checks the config for missing or inconsistent settings.
+func (c DBConfig) Validate() error {
+	if c.HostURL == "" || c.DBName == "" {
+		return errors.New("invalid connection info. Missing host and db info")
+	}
+
+	var problems []string
+	if c.MaxPoolSize > 0 && c.MinPoolSize > c.MaxPoolSize {
+		problems = append(problems, fmt.Sprintf("min pool size %d exceeds max pool size %d", c.MinPoolSize, c.MaxPoolSize))
+	}
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"max connection idle time", c.MaxConnIdleTime},
+		{"connect timeout", c.ConnectTimeout},
+		{"server selection timeout", c.ServerSelectionTimeout},
+		{"socket timeout", c.SocketTimeout},
+		{"retry backoff", c.RetryBackoff},
+		{"max retry backoff", c.MaxRetryBackoff},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative, got %s", d.name, d.value))
+		}
+	}
+	if _, err := c.ReadPref().readPref(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, compressor := range c.Compressors {
+		switch compressor {
+		case CompressorZstd, CompressorSnappy, CompressorZlib:
+		default:
+			problems = append(problems, fmt.Sprintf("unsupported compressor %q, expected one of zstd, snappy, zlib", compressor))
+		}
+	}
+	for _, file := range []string{c.TLSCAFile, c.TLSCertificateKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			problems = append(problems, fmt.Sprintf("tls file: %s", err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config for db %s: %s", c.Name(), strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Name returns the name the database is registered under: Alias when set, DBName otherwise.
+func (c DBConfig) Name() string {
+	if c.Alias != "" {
+		return c.Alias
+	}
+	return c.DBName
+}
+
+// ReadPref returns the read preference configured by Mode, TagSets and MaxStaleness.
+func (c DBConfig) ReadPref() ReadPref {
+	return ReadPref{Mode: c.Mode, TagSets: c.TagSets, MaxStaleness: c.MaxStaleness}
+}
+
+// connectTimeout returns the configured connect timeout or the default one.
+func (c DBConfig) connectTimeout() time.Duration {
+	if c.ConnectTimeout > 0 {
+		return c.ConnectTimeout
+	}
+	return defaultConnectTimeout
+}
+
+// connectRetries returns the configured number of connect retries, the default one when not set.
+func (c DBConfig) connectRetries() int {
+	switch {
+	case c.ConnectRetries < 0:
+		return 0
+	case c.ConnectRetries == 0:
+		return defaultConnectRetries
+	}
+	return c.ConnectRetries
+}
+
+// retryBackoff returns the configured initial retry backoff or the default one.
+func (c DBConfig) retryBackoff() time.Duration {
+	if c.RetryBackoff > 0 {
+		return c.RetryBackoff
+	}
+	return defaultRetryBackoff
+}
+
+// maxRetryBackoff returns the configured maximum retry backoff or the default one.
+func (c DBConfig) maxRetryBackoff() time.Duration {
+	if c.MaxRetryBackoff > 0 {
+		return c.MaxRetryBackoff
+	}
+	return defaultMaxRetryBackoff
+}
+
+// ClientOptions validates the config and maps it onto driver client options. Settings left at their zero value
+// are taken from HostURL.
+func (c DBConfig) ClientOptions() (*options.ClientOptions, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	opts := options.Client().ApplyURI(c.HostURL)
+	if c.AppName != "" {
+		opts.SetAppName(c.AppName)
+	}
+	if c.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(c.MaxPoolSize)
+	}
+	if c.MinPoolSize > 0 {
+		opts.SetMinPoolSize(c.MinPoolSize)
+	}
+	if c.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(c.MaxConnIdleTime)
+	}
+	opts.SetConnectTimeout(c.connectTimeout())
+	if c.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(c.ServerSelectionTimeout)
+	}
+	if c.SocketTimeout > 0 {
+		opts.SetSocketTimeout(c.SocketTimeout)
+	}
+	if len(c.Compressors) > 0 {
+		opts.SetCompressors(c.Compressors)
+	}
+	if c.RetryWrites != nil {
+		opts.SetRetryWrites(*c.RetryWrites)
+	}
+	if c.RetryReads != nil {
+		opts.SetRetryReads(*c.RetryReads)
+	}
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config for db %s: %w", c.Name(), err)
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config for db %s: %w", c.Name(), err)
+	}
+	return opts, nil
+}
+
+// tlsConfig builds the TLS configuration from the TLS settings, or returns nil when TLS is not configured.
+func (c DBConfig) tlsConfig() (*tls.Config, error) {
+	if !c.TLS && c.TLSCAFile == "" && c.TLSCertificateKeyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading tls ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls ca file %s", c.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.TLSCertificateKeyFile != "" {
+		pem, err := os.ReadFile(c.TLSCertificateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading tls certificate key file: %w", err)
+		}
+		cert, err := tls.X509KeyPair(pem, pem)
+		if err != nil {
+			return nil, fmt.Errorf("loading tls certificate key file %s: %w", c.TLSCertificateKeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,250 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfigsFromEnv builds a DBConfig for every database alias found in environment variables named
+// <prefix>.<alias>.<key>, e.g. db.main.url, db.main.name and db.main.poolSize for the prefix "db". Supported
+// keys are url, name, appName, poolSize (or maxPoolSize), minPoolSize, maxIdleTime, connectTimeout,
+// serverSelectionTimeout, socketTimeout, compressors, retryWrites, retryReads, tls, tlsCAFile,
+// tlsCertificateKeyFile, mode, tagSets, maxStaleness, verifyOnSetup, connectRetries, retryBackoff,
+// maxRetryBackoff and lazy; durations use time.ParseDuration syntax such as 5s and tag sets are written as
+// "dc:east,rack:1;dc:west". Each config is registered under its alias, see DBConfig.Alias. Configs are returned
+// sorted by alias.
+//
+// Variables not shaped <prefix>.<alias>.<key>, such as db.host, and unknown keys are skipped and logged at debug
+// level, so aliases without any known key yield no config. Only invalid values of known keys are errors.
+func LoadConfigsFromEnv(prefix string) ([]DBConfig, error) {
+	prefix = strings.TrimSuffix(prefix, ".") + "."
+	settings := make(map[string]map[string]string)
+	for _, env := range os.Environ() {
+		key, value, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		alias, setting, ok := strings.Cut(strings.TrimPrefix(key, prefix), ".")
+		if !ok || alias == "" || setting == "" {
+			// Variables such as db.host, set for other purposes, must not stop the service from starting.
+			DefaultRegistry().Logger().Debug("Skipping db config variable, expected "+prefix+"<alias>.<key>", "variable", key)
+			continue
+		}
+		if settings[alias] == nil {
+			settings[alias] = make(map[string]string)
+		}
+		settings[alias][setting] = value
+	}
+	return buildConfigs(settings)
+}
+
+// LoadConfigsFromFile builds a DBConfig for every database alias in the given YAML (.yaml, .yml) or JSON
+// (.json) file. The file maps each alias to its settings, using the same keys as LoadConfigsFromEnv:
+//
+//	main:
+//	  url: mongodb://localhost:27017
+//	  name: root-db
+//	  poolSize: 50
+//	  compressors: [zstd, snappy]
+//	  mode: secondaryPreferred
+//	  tagSets: [{dc: east}, {}]
+//
+// As with LoadConfigsFromEnv, unknown keys are skipped and logged at debug level.
+func LoadConfigsFromFile(path string) ([]DBConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported db config file format %q, expected .yaml, .yml or .json", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing db config file %s: %w", path, err)
+	}
+
+	settings := make(map[string]map[string]string, len(raw))
+	for alias, values := range raw {
+		settings[alias] = make(map[string]string, len(values))
+		for key, value := range values {
+			settings[alias][key] = settingString(value)
+		}
+	}
+	return buildConfigs(settings)
+}
+
+// settingString converts a value decoded from a config file to the string form used by environment variables.
+// Lists are joined with commas, except lists of maps (tag sets) which are joined with semicolons.
+func settingString(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		separator := ","
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); ok {
+				separator = ";"
+			}
+			items = append(items, settingString(item))
+		}
+		return strings.Join(items, separator)
+	case map[string]interface{}:
+		pairs := make([]string, 0, len(v))
+		for name, tagValue := range v {
+			pairs = append(pairs, fmt.Sprintf("%s:%v", name, tagValue))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// configKeys maps the supported setting keys, lower cased, to the function applying them to a DBConfig.
+var configKeys = map[string]func(*DBConfig, string) error{
+	"url":                    func(c *DBConfig, v string) error { c.HostURL = v; return nil },
+	"name":                   func(c *DBConfig, v string) error { c.DBName = v; return nil },
+	"appname":                func(c *DBConfig, v string) error { c.AppName = v; return nil },
+	"poolsize":               func(c *DBConfig, v string) error { return parseUint(v, &c.MaxPoolSize) },
+	"maxpoolsize":            func(c *DBConfig, v string) error { return parseUint(v, &c.MaxPoolSize) },
+	"minpoolsize":            func(c *DBConfig, v string) error { return parseUint(v, &c.MinPoolSize) },
+	"maxidletime":            func(c *DBConfig, v string) error { return parseDuration(v, &c.MaxConnIdleTime) },
+	"connecttimeout":         func(c *DBConfig, v string) error { return parseDuration(v, &c.ConnectTimeout) },
+	"serverselectiontimeout": func(c *DBConfig, v string) error { return parseDuration(v, &c.ServerSelectionTimeout) },
+	"sockettimeout":          func(c *DBConfig, v string) error { return parseDuration(v, &c.SocketTimeout) },
+	"compressors":            func(c *DBConfig, v string) error { c.Compressors = splitList(v); return nil },
+	"retrywrites":            func(c *DBConfig, v string) error { return parseBoolPtr(v, &c.RetryWrites) },
+	"retryreads":             func(c *DBConfig, v string) error { return parseBoolPtr(v, &c.RetryReads) },
+	"tls":                    func(c *DBConfig, v string) error { return parseBool(v, &c.TLS) },
+	"tlscafile":              func(c *DBConfig, v string) error { c.TLSCAFile = v; return nil },
+	"tlscertificatekeyfile":  func(c *DBConfig, v string) error { c.TLSCertificateKeyFile = v; return nil },
+	"mode":                   func(c *DBConfig, v string) error { return parseMode(v, &c.Mode) },
+	"tagsets":                func(c *DBConfig, v string) error { return parseTagSetsInto(v, &c.TagSets) },
+	"maxstaleness":           func(c *DBConfig, v string) error { return parseDuration(v, &c.MaxStaleness) },
+	"verifyonsetup":          func(c *DBConfig, v string) error { return parseBool(v, &c.VerifyOnSetup) },
+	"connectretries":         func(c *DBConfig, v string) error { return parseInt(v, &c.ConnectRetries) },
+	"retrybackoff":           func(c *DBConfig, v string) error { return parseDuration(v, &c.RetryBackoff) },
+	"maxretrybackoff":        func(c *DBConfig, v string) error { return parseDuration(v, &c.MaxRetryBackoff) },
+	"lazy":                   func(c *DBConfig, v string) error { return parseBool(v, &c.Lazy) },
+}
+
+// buildConfigs builds and validates a DBConfig per alias from its raw settings, skipping unknown keys and the
+// aliases without any known key.
+func buildConfigs(settings map[string]map[string]string) ([]DBConfig, error) {
+	aliases := make([]string, 0, len(settings))
+	for alias := range settings {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	configs := make([]DBConfig, 0, len(aliases))
+	for _, alias := range aliases {
+		config := DBConfig{Alias: alias}
+		known := false
+		for key, value := range settings[alias] {
+			apply, ok := configKeys[strings.ToLower(key)]
+			if !ok {
+				DefaultRegistry().Logger().Debug("Skipping unknown db config key", "db", alias, "key", key)
+				continue
+			}
+			known = true
+			if err := apply(&config, strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("db %s: invalid %s: %w", alias, key, err)
+			}
+		}
+		if !known {
+			continue
+		}
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("db %s: %w", alias, err)
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+func parseUint(value string, target *uint64) error {
+	u, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	*target = u
+	return nil
+}
+
+func parseInt(value string, target *int) error {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*target = i
+	return nil
+}
+
+func parseDuration(value string, target *time.Duration) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*target = d
+	return nil
+}
+
+func parseBool(value string, target *bool) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*target = b
+	return nil
+}
+
+func parseBoolPtr(value string, target **bool) error {
+	var b bool
+	if err := parseBool(value, &b); err != nil {
+		return err
+	}
+	*target = &b
+	return nil
+}
+
+func parseMode(value string, target *Mode) error {
+	mode, err := ParseMode(value)
+	if err != nil {
+		return err
+	}
+	*target = mode
+	return nil
+}
+
+func parseTagSetsInto(value string, target *[]map[string]string) error {
+	sets, err := parseTagSets(value)
+	if err != nil {
+		return err
+	}
+	*target = sets
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Defaults for the connect retries and their backoff, see DBConfig.ConnectRetries.
+const (
+	defaultConnectRetries  = 3
+	defaultRetryBackoff    = 500 * time.Millisecond
+	defaultMaxRetryBackoff = 30 * time.Second
+)
+
+// backoff returns how long to wait before retry attempt n, counted from 0: base doubled n times and capped at
+// max, of which a random half is dropped so that instances restarting together do not retry in lockstep.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// connect connects the database's client, when it was set up by the registry and is not connected yet. The
+// driver connects to the cluster in the background, so this does not fail when the cluster is unreachable.
+func (db Db) connect(ctx context.Context) error {
+	if db.shared == nil {
+		return nil
+	}
+	return db.shared.connect(ctx)
+}
+
+// ping pings the cluster with the database's read preference to make sure it is reachable.
+func (db Db) ping(ctx context.Context) error {
+	rp, err := db.Config.ReadPref().readPref()
+	if err != nil {
+		return err
+	}
+	return db.Client.Ping(ctx, rp)
+}
+
+// ensureConnected connects the client of a database set up in lazy mode on its first use. The driver connects
+// to the cluster in the background, so this does not wait for it to be reachable.
+func (db Db) ensureConnected() error {
+	if db.shared == nil || db.shared.isConnected() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), db.Config.connectTimeout())
+	defer cancel()
+	return db.connect(ctx)
+}
+
+// connectWithRetry connects the database's client and, with DBConfig.VerifyOnSetup, pings the cluster. As only
+// the ping reaches the cluster, it is the one retried with backoff as configured by DBConfig.ConnectRetries. Each
+// attempt is bounded by the connect timeout, and the retries stop when the registry shuts down.
+func (r *Registry) connectWithRetry(db Db) error {
+	config := db.Config
+	ctx, cancel := r.setupContext()
+	defer cancel()
+	connectCtx, cancelConnect := context.WithTimeout(ctx, config.connectTimeout())
+	err := db.connect(connectCtx)
+	cancelConnect()
+	if err != nil || !config.VerifyOnSetup {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		pingCtx, cancelPing := context.WithTimeout(ctx, config.connectTimeout())
+		err := db.ping(pingCtx)
+		cancelPing()
+		if err == nil || attempt >= config.connectRetries() {
+			return err
+		}
+
+		delay := backoff(attempt, config.retryBackoff(), config.maxRetryBackoff())
+		r.Logger().Warn("MongoDB connection attempt failed, retrying", "db", config.Name(), "attempt", attempt+1,
+			"retryIn", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("registry shut down while connecting: %w", err)
+		case <-timer.C:
+		}
+	}
+}
+
+// setupContext returns a context canceled when the registry shuts down, bounding the setups in progress.
+func (r *Registry) setupContext() (context.Context, context.CancelFunc) {
+	r.mu.RLock()
+	shutdown := r.shutdown
+	r.mu.RUnlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
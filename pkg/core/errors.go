@@ -0,0 +1,87 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownDatabase is matched by the errors returned for database names that are not registered.
+var ErrUnknownDatabase = errors.New("unknown database")
+
+// ErrNoDefaultDatabase is returned when no default database is set and the registry does not hold exactly one.
+var ErrNoDefaultDatabase = errors.New("no default database")
+
+// ErrEmptyUpdate is returned when running an Update holding no operator.
+var ErrEmptyUpdate = errors.New("empty update")
+
+// UnknownDatabaseError is returned when looking up a database name that is not registered. It matches
+// ErrUnknownDatabase with errors.Is.
+type UnknownDatabaseError struct {
+	Name string
+}
+
+func (e *UnknownDatabaseError) Error() string {
+	return fmt.Sprintf("unknown database %q: connection not available. Perform 'Setup' first", e.Name)
+}
+
+// Is reports whether target is ErrUnknownDatabase.
+func (e *UnknownDatabaseError) Is(target error) bool {
+	return target == ErrUnknownDatabase
+}
+
+// SetupError is returned by SetupMongoDB when one or more configs fail to set up. Errors maps the database name
+// to the error returned while setting it up; the other databases are set up and registered.
+type SetupError struct {
+	Errors map[string]error
+}
+
+// Error lists the databases that failed to set up, sorted by name.
+func (e *SetupError) Error() string {
+	return fmt.Sprintf("failed to set up %d database(s): %s", len(e.Errors), joinDBErrors(e.Errors))
+}
+
+// Unwrap returns the individual setup errors so they can be matched with errors.Is and errors.As.
+func (e *SetupError) Unwrap() []error {
+	return dbErrorList(e.Errors)
+}
+
+// ShutdownError is returned when one or more clients fail to close. Errors maps the database name to the error
+// returned while closing it.
+type ShutdownError struct {
+	Errors map[string]error
+}
+
+// Error lists the databases that failed to close, sorted by name.
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("failed to close %d database(s): %s", len(e.Errors), joinDBErrors(e.Errors))
+}
+
+// Unwrap returns the individual close errors so they can be matched with errors.Is and errors.As.
+func (e *ShutdownError) Unwrap() []error {
+	return dbErrorList(e.Errors)
+}
+
+// joinDBErrors formats per database errors as "name: error" sorted by database name.
+func joinDBErrors(errs map[string]error) string {
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", name, errs[name]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// dbErrorList returns the errors of a per database error map.
+func dbErrorList(errs map[string]error) []error {
+	list := make([]error, 0, len(errs))
+	for _, err := range errs {
+		list = append(list, err)
+	}
+	return list
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindOneAndOptions are the options of FindOneAndUpdate, FindOneAndReplace and FindOneAndDelete. ReturnAfter
+// decodes the document as it is after the change instead of before it, Upsert inserts a document when none
+// matches, Sort picks the document to change when several match and Projection limits the decoded fields.
+// ReturnAfter and Upsert do not apply to FindOneAndDelete.
+type FindOneAndOptions struct {
+	ReturnAfter bool
+	Upsert      bool
+	Sort        []SortField
+	Projection  Q
+}
+
+// returnDocument returns the driver setting for ReturnAfter.
+func (o FindOneAndOptions) returnDocument() options.ReturnDocument {
+	if o.ReturnAfter {
+		return options.After
+	}
+	return options.Before
+}
+
+// FindOneAndUpdate atomically applies the update to the first document matching the selector and decodes it
+// into document, as it was before the update unless ReturnAfter is set. It returns mongo.ErrNoDocuments when
+// nothing matched, which also happens on upserts that do not return the document after the update.
+//
+//	job := &Job{}
+//	err := conn.FindOneAndUpdate(ctx, core.Where("status").Eq("pending"), core.NewUpdate().Set("status", "running"),
+//		job, core.FindOneAndOptions{ReturnAfter: true, Sort: []core.SortField{core.Asc("createdDate")}})
+func (s *DBConnection) FindOneAndUpdate(ctx context.Context, selector Q, updater Updater, document Document, opts FindOneAndOptions) error {
+	ctx = s.context(ctx)
+	update, err := nonEmpty(updater)
+	if err != nil {
+		return err
+	}
+	findOpts := options.FindOneAndUpdate().SetReturnDocument(opts.returnDocument())
+	if opts.Upsert || update.upsert {
+		findOpts.SetUpsert(true)
+	}
+	if len(update.arrayFilters) > 0 {
+		findOpts.SetArrayFilters(options.ArrayFilters{Filters: update.arrayFilters})
+	}
+	if len(opts.Sort) > 0 {
+		findOpts.SetSort(sortD(opts.Sort, false))
+	}
+	if opts.Projection != nil {
+		findOpts.SetProjection(opts.Projection)
+	}
+	res := s.Collection(document.CollectionName()).FindOneAndUpdate(ctx, selector, update.Q(), findOpts)
+	return s.decodeResult(res, selector, document)
+}
+
+// FindOneAndReplace atomically replaces the first document matching the selector with replacement and decodes
+// it into document, as it was before the replacement unless ReturnAfter is set.
+func (s *DBConnection) FindOneAndReplace(ctx context.Context, selector Q, replacement Document, document Document, opts FindOneAndOptions) error {
+	ctx = s.context(ctx)
+	findOpts := options.FindOneAndReplace().SetReturnDocument(opts.returnDocument())
+	if opts.Upsert {
+		findOpts.SetUpsert(true)
+	}
+	if len(opts.Sort) > 0 {
+		findOpts.SetSort(sortD(opts.Sort, false))
+	}
+	if opts.Projection != nil {
+		findOpts.SetProjection(opts.Projection)
+	}
+	res := s.Collection(replacement.CollectionName()).FindOneAndReplace(ctx, selector, replacement, findOpts)
+	return s.decodeResult(res, selector, document)
+}
+
+// FindOneAndDelete atomically deletes the first document matching the selector and decodes it into document.
+func (s *DBConnection) FindOneAndDelete(ctx context.Context, selector Q, document Document, opts FindOneAndOptions) error {
+	ctx = s.context(ctx)
+	findOpts := options.FindOneAndDelete()
+	if len(opts.Sort) > 0 {
+		findOpts.SetSort(sortD(opts.Sort, false))
+	}
+	if opts.Projection != nil {
+		findOpts.SetProjection(opts.Projection)
+	}
+	res := s.Collection(document.CollectionName()).FindOneAndDelete(ctx, selector, findOpts)
+	return s.decodeResult(res, selector, document)
+}
+
+// decodeResult decodes the result into document, logging errors other than mongo.ErrNoDocuments like Find.
+func (s *DBConnection) decodeResult(res *mongo.SingleResult, selector Q, document Document) error {
+	err := res.Decode(document)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		s.log().Error("Error fetching document", "collection", document.CollectionName(), "query", selector, "error", err)
+	}
+	return err
+}
+
+// FindOneAndUpdate atomically applies the update to the first document matching the selector and returns it,
+// see DBConnection.FindOneAndUpdate.
+func (r *Repository[T]) FindOneAndUpdate(ctx context.Context, selector Q, update Updater, opts FindOneAndOptions) (T, error) {
+	document := newDocument[T]()
+	if err := r.conn.FindOneAndUpdate(ctx, selector, update, documentTarget(&document), opts); err != nil {
+		var zero T
+		return zero, err
+	}
+	return document, nil
+}
+
+// FindOneAndReplace atomically replaces the first document matching the selector with replacement and returns
+// it, see DBConnection.FindOneAndReplace.
+func (r *Repository[T]) FindOneAndReplace(ctx context.Context, selector Q, replacement T, opts FindOneAndOptions) (T, error) {
+	document := newDocument[T]()
+	if err := r.conn.FindOneAndReplace(ctx, selector, replacement, documentTarget(&document), opts); err != nil {
+		var zero T
+		return zero, err
+	}
+	return document, nil
+}
+
+// FindOneAndDelete atomically deletes the first document matching the selector and returns it.
+func (r *Repository[T]) FindOneAndDelete(ctx context.Context, selector Q, opts FindOneAndOptions) (T, error) {
+	document := newDocument[T]()
+	if err := r.conn.FindOneAndDelete(ctx, selector, documentTarget(&document), opts); err != nil {
+		var zero T
+		return zero, err
+	}
+	return document, nil
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// healthCheckTimeout bounds the checks run by HealthHandler when the request has no deadline.
+const healthCheckTimeout = 5 * time.Second
+
+// DatabaseHealth is the health of a registered database as reported by HealthCheck.
+type DatabaseHealth struct {
+	// Name is the name the database is registered under and Database its name on the cluster.
+	Name     string `json:"name"`
+	Database string `json:"database"`
+	// Healthy reports whether the database answered a ping with its configured read preference and its primary
+	// is reachable. It is false whenever Error is set.
+	Healthy bool `json:"healthy"`
+	// LatencyMS is the round trip time of the ping, in milliseconds.
+	LatencyMS float64 `json:"latencyMs"`
+	// PrimaryReachable reports whether the primary answered a ping, i.e. whether writes can go through.
+	PrimaryReachable bool `json:"primaryReachable"`
+	// ReplicaSet, Primary and Members describe the replica set topology as seen by the server. They are empty
+	// for standalone servers.
+	ReplicaSet string   `json:"replicaSet,omitempty"`
+	Primary    string   `json:"primary,omitempty"`
+	Members    []string `json:"members,omitempty"`
+	// Error is the error of this check and LastError the most recent error of any check, with its time.
+	Error       string     `json:"error,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+	CheckedAt   time.Time  `json:"checkedAt"`
+}
+
+// HealthReport is the result of HealthCheck. Healthy is true when every database is.
+type HealthReport struct {
+	Healthy   bool             `json:"healthy"`
+	Databases []DatabaseHealth `json:"databases"`
+}
+
+// healthError is the last error recorded for a database by HealthCheck.
+type healthError struct {
+	message string
+	at      time.Time
+}
+
+// helloResult holds the fields of the hello command response describing the replica set.
+type helloResult struct {
+	SetName   string   `bson:"setName"`
+	Primary   string   `bson:"primary"`
+	Hosts     []string `bson:"hosts"`
+	Passives  []string `bson:"passives"`
+	Arbiters  []string `bson:"arbiters"`
+	IsPrimary bool     `bson:"isWritablePrimary"`
+}
+
+// HealthCheck pings every registered database concurrently and reports their status, sorted by name. The
+// context bounds the checks; without a deadline an unreachable primary is waited for up to the server
+// selection timeout.
+func (r *Registry) HealthCheck(ctx context.Context) HealthReport {
+	names := r.Names()
+	report := HealthReport{Healthy: true, Databases: make([]DatabaseHealth, len(names))}
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		db, ok := r.Get(name)
+		if !ok {
+			report.Databases[i] = DatabaseHealth{Name: name, Error: (&UnknownDatabaseError{Name: name}).Error(), CheckedAt: time.Now()}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string, db Db) {
+			defer wg.Done()
+			report.Databases[i] = db.health(ctx, name)
+		}(i, name, db)
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.healthErrors == nil {
+		r.healthErrors = make(map[string]healthError)
+	}
+	for i := range report.Databases {
+		health := &report.Databases[i]
+		// Databases closed or removed while being checked do not get their error recorded again.
+		if _, registered := r.dbs[health.Name]; health.Error != "" && registered {
+			r.healthErrors[health.Name] = healthError{message: health.Error, at: health.CheckedAt}
+		}
+		if last, ok := r.healthErrors[health.Name]; ok {
+			at := last.at
+			health.LastError, health.LastErrorAt = last.message, &at
+		}
+		report.Healthy = report.Healthy && health.Healthy
+	}
+	return report
+}
+
+// health checks the database.
+func (db Db) health(ctx context.Context, name string) DatabaseHealth {
+	health := DatabaseHealth{Name: name, Database: db.Config.DBName, CheckedAt: time.Now()}
+	if db.Client == nil {
+		health.Error = "database has no client"
+		return health
+	}
+
+	rp, err := db.Config.ReadPref().readPref()
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	if err := db.ensureConnected(); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	start := time.Now()
+	if err := db.Client.Ping(ctx, rp); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	health.Healthy = true
+
+	var hello helloResult
+	helloOpts := options.RunCmd().SetReadPreference(readpref.Nearest())
+	if err := db.Client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}, helloOpts).Decode(&hello); err == nil {
+		health.ReplicaSet, health.Primary = hello.SetName, hello.Primary
+		health.Members = append(append(append(health.Members, hello.Hosts...), hello.Passives...), hello.Arbiters...)
+	}
+
+	if hello.IsPrimary {
+		health.PrimaryReachable = true
+	} else if err := db.Client.Ping(ctx, readpref.Primary()); err == nil {
+		health.PrimaryReachable = true
+	} else {
+		health.Healthy = false
+		health.Error = "primary unreachable: " + err.Error()
+	}
+	return health
+}
+
+// HealthHandler returns an http.Handler serving HealthCheck as JSON, for liveness and readiness probes. It
+// responds with 200 when every database is healthy and 503 otherwise.
+func (r *Registry) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+		}
+
+		report := r.HealthCheck(ctx)
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			r.Logger().Warn("Error writing health report", "error", err)
+		}
+	})
+}
+
+// HealthCheck reports the status of every database registered in the default registry.
+func HealthCheck(ctx context.Context) HealthReport {
+	return defaultRegistry.HealthCheck(ctx)
+}
+
+// HealthHandler returns an http.Handler serving the health of the default registry as JSON.
+func HealthHandler() http.Handler {
+	return defaultRegistry.HealthHandler()
+}
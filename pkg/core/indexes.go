@@ -0,0 +1,350 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares an index of a collection, see Indexed.
+type IndexSpec struct {
+	// Keys are the indexed fields in order, with 1 or -1 for ascending or descending, or "text", "hashed" or
+	// "2dsphere", e.g. bson.D{{Key: "customerId", Value: 1}, {Key: "createdDate", Value: -1}}.
+	Keys bson.D
+	// Name defaults to the name generated by the server from the keys, e.g. "customerId_1_createdDate_-1".
+	Name   string
+	Unique bool
+	Sparse bool
+	// PartialFilter only indexes the documents matching it.
+	PartialFilter Q
+	// ExpireAfter makes a TTL index removing documents once the date in the indexed field is older, 0 for none.
+	ExpireAfter time.Duration
+	// Collation sets the language rules of string comparisons.
+	Collation *options.Collation
+	// Weights and DefaultLanguage apply to text indexes.
+	Weights         Q
+	DefaultLanguage string
+}
+
+// Indexed is implemented by documents declaring the indexes of their collection, for EnsureIndexes.
+type Indexed interface {
+	Document
+	Indexes() []IndexSpec
+}
+
+// IndexOptions are the options of EnsureIndexesWithOpts. With DryRun, missing indexes are reported but not
+// created.
+type IndexOptions struct {
+	DryRun bool
+}
+
+// IndexConflict is an existing index that does not match the declared one with the same keys or name.
+type IndexConflict struct {
+	Name   string
+	Reason string
+}
+
+// IndexReport compares the declared indexes of a collection with the existing ones. Missing are the declared
+// indexes that did not exist, Created the names of those that were created, which is none in dry-run mode.
+// Extra are the names of the existing indexes that are not declared, _id_ aside. Conflicting indexes are never
+// changed: dropping and recreating them is left to a migration.
+type IndexReport struct {
+	Collection  string
+	Missing     []IndexSpec
+	Created     []string
+	Extra       []string
+	Conflicting []IndexConflict
+}
+
+// existingIndex is an index as listed by the server.
+type existingIndex struct {
+	Name               string             `bson:"name"`
+	Key                bson.D             `bson:"key"`
+	Unique             bool               `bson:"unique"`
+	Sparse             bool               `bson:"sparse"`
+	ExpireAfterSeconds *int32             `bson:"expireAfterSeconds"`
+	PartialFilter      bson.M             `bson:"partialFilterExpression"`
+	Collation          *options.Collation `bson:"collation"`
+	Weights            bson.M             `bson:"weights"`
+}
+
+// EnsureIndexes creates the missing indexes declared by the documents implementing Indexed and reports the
+// extra and conflicting ones, one report per document. Documents not implementing Indexed are skipped.
+func (s *DBConnection) EnsureIndexes(ctx context.Context, documents ...Document) ([]IndexReport, error) {
+	return s.EnsureIndexesWithOpts(ctx, IndexOptions{}, documents...)
+}
+
+// EnsureIndexesWithOpts is EnsureIndexes with options, e.g. a dry run at startup to report drift without
+// changing anything.
+func (s *DBConnection) EnsureIndexesWithOpts(ctx context.Context, opts IndexOptions, documents ...Document) ([]IndexReport, error) {
+	reports := make([]IndexReport, 0, len(documents))
+	for _, document := range documents {
+		indexed, ok := document.(Indexed)
+		if !ok {
+			continue
+		}
+		report, err := s.ensureIndexes(ctx, indexed, opts)
+		if err != nil {
+			return reports, fmt.Errorf("ensuring indexes of %s: %w", document.CollectionName(), err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// ensureIndexes compares the indexes declared by the document with the existing ones and creates the missing
+// ones.
+func (s *DBConnection) ensureIndexes(ctx context.Context, document Indexed, opts IndexOptions) (IndexReport, error) {
+	collectionName := document.CollectionName()
+	report := IndexReport{Collection: collectionName}
+	coll := s.Collection(collectionName)
+	existing, err := listIndexes(ctx, coll)
+	if err != nil {
+		return report, err
+	}
+
+	matched := make(map[string]bool)
+	var models []mongo.IndexModel
+	for _, spec := range document.Indexes() {
+		name := spec.indexName()
+		index, found := findIndex(existing, spec)
+		if !found {
+			if byName, ok := existing[name]; ok {
+				matched[name] = true
+				report.Conflicting = append(report.Conflicting, IndexConflict{Name: name,
+					Reason: fmt.Sprintf("keys are %s, declared %s", keysSignature(byName.Key, byName.Weights), spec.keysSignature())})
+				continue
+			}
+			report.Missing = append(report.Missing, spec)
+			models = append(models, spec.Model())
+			continue
+		}
+
+		matched[index.Name] = true
+		if reason := spec.conflict(index); reason != "" {
+			report.Conflicting = append(report.Conflicting, IndexConflict{Name: index.Name, Reason: reason})
+		}
+	}
+	for name := range existing {
+		if name != "_id_" && !matched[name] {
+			report.Extra = append(report.Extra, name)
+		}
+	}
+	sort.Strings(report.Extra)
+
+	for _, conflict := range report.Conflicting {
+		s.log().Warn("Index conflicts with its declaration", "collection", collectionName, "index", conflict.Name, "reason", conflict.Reason)
+	}
+	for _, name := range report.Extra {
+		s.log().Warn("Index is not declared", "collection", collectionName, "index", name)
+	}
+	if opts.DryRun || len(models) == 0 {
+		for _, spec := range report.Missing {
+			s.log().Info("Index is missing", "collection", collectionName, "index", spec.indexName())
+		}
+		return report, nil
+	}
+
+	created, err := coll.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return report, err
+	}
+	report.Created = created
+	s.log().Info("Created indexes", "collection", collectionName, "indexes", created)
+	return report, nil
+}
+
+// listIndexes returns the indexes of the collection by name, none when the collection does not exist.
+func listIndexes(ctx context.Context, coll *mongo.Collection) (map[string]existingIndex, error) {
+	indexes := make(map[string]existingIndex)
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) && serverErr.HasErrorCode(26) { // NamespaceNotFound
+			return indexes, nil
+		}
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var index existingIndex
+		if err := cursor.Decode(&index); err != nil {
+			return nil, err
+		}
+		indexes[index.Name] = index
+	}
+	return indexes, cursor.Err()
+}
+
+// findIndex returns the existing index with the same keys as the spec.
+func findIndex(existing map[string]existingIndex, spec IndexSpec) (existingIndex, bool) {
+	signature := spec.keysSignature()
+	for _, index := range existing {
+		if keysSignature(index.Key, index.Weights) == signature {
+			return index, true
+		}
+	}
+	return existingIndex{}, false
+}
+
+// indexName returns the name of the index, generated from the keys like the server does when not set.
+func (spec IndexSpec) indexName() string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+	parts := make([]string, 0, len(spec.Keys))
+	for _, key := range spec.Keys {
+		parts = append(parts, fmt.Sprintf("%s_%v", key.Key, key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// keysSignature identifies the keys of the spec, see keysSignature.
+func (spec IndexSpec) keysSignature() string {
+	var fields []string
+	var textFields []string
+	for _, key := range spec.Keys {
+		if key.Value == "text" {
+			textFields = append(textFields, key.Key)
+			continue
+		}
+		fields = append(fields, key.Key+":"+keyType(key.Value))
+	}
+	if len(textFields) > 0 {
+		sort.Strings(textFields)
+		fields = append(fields, "text("+strings.Join(textFields, ",")+")")
+	}
+	return strings.Join(fields, " ")
+}
+
+// keysSignature identifies index keys independently of the numeric types of their directions. Text indexes are
+// listed by the server with internal _fts and _ftsx keys and their fields as weights, which are put back
+// together.
+func keysSignature(keys bson.D, weights bson.M) string {
+	var fields []string
+	text := false
+	for _, key := range keys {
+		switch key.Key {
+		case "_fts":
+			text = true
+		case "_ftsx":
+		default:
+			fields = append(fields, key.Key+":"+keyType(key.Value))
+		}
+	}
+	if text {
+		textFields := make([]string, 0, len(weights))
+		for field := range weights {
+			textFields = append(textFields, field)
+		}
+		sort.Strings(textFields)
+		fields = append(fields, "text("+strings.Join(textFields, ",")+")")
+	}
+	return strings.Join(fields, " ")
+}
+
+// keyType normalizes the direction or type of an index key: 1 and -1 whatever their numeric type.
+func keyType(value interface{}) string {
+	switch v := value.(type) {
+	case int:
+		return fmt.Sprint(v)
+	case int32:
+		return fmt.Sprint(v)
+	case int64:
+		return fmt.Sprint(v)
+	case float64:
+		return fmt.Sprint(int64(v))
+	}
+	return fmt.Sprint(value)
+}
+
+// conflict returns why the existing index with the same keys does not match the spec, empty when it does.
+func (spec IndexSpec) conflict(index existingIndex) string {
+	var reasons []string
+	if spec.Name != "" && spec.Name != index.Name {
+		reasons = append(reasons, fmt.Sprintf("named %s, declared %s", index.Name, spec.Name))
+	}
+	if spec.Unique != index.Unique {
+		reasons = append(reasons, fmt.Sprintf("unique is %t, declared %t", index.Unique, spec.Unique))
+	}
+	if spec.Sparse != index.Sparse {
+		reasons = append(reasons, fmt.Sprintf("sparse is %t, declared %t", index.Sparse, spec.Sparse))
+	}
+	var expireAfter time.Duration
+	if index.ExpireAfterSeconds != nil {
+		expireAfter = time.Duration(*index.ExpireAfterSeconds) * time.Second
+	}
+	if spec.ExpireAfter != expireAfter {
+		reasons = append(reasons, fmt.Sprintf("expires after %s, declared %s", expireAfter, spec.ExpireAfter))
+	}
+	if !sameFilter(spec.PartialFilter, index.PartialFilter) {
+		reasons = append(reasons, "partial filter differs")
+	}
+	if !sameCollation(spec.Collation, index.Collation) {
+		reasons = append(reasons, "collation differs")
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// sameFilter reports whether the declared and existing partial filters are the same, whatever their key order.
+func sameFilter(declared Q, existing bson.M) bool {
+	if len(declared) == 0 || len(existing) == 0 {
+		return len(declared) == len(existing)
+	}
+	a, err := bson.Marshal(declared.D())
+	if err != nil {
+		return false
+	}
+	// Round trip the declared filter so that its values have the types the server would list them with.
+	var roundTrip bson.M
+	if err := bson.Unmarshal(a, &roundTrip); err != nil {
+		return false
+	}
+	a, _ = bson.Marshal(Q(roundTrip).D())
+	b, err := bson.Marshal(Q(existing).D())
+	return err == nil && bytes.Equal(a, b)
+}
+
+// sameCollation reports whether the existing collation matches the declared locale and strength. The server
+// lists every collation option, so the others are not compared.
+func sameCollation(declared, existing *options.Collation) bool {
+	if declared == nil || existing == nil {
+		return declared == nil && (existing == nil || existing.Locale == "simple")
+	}
+	return declared.Locale == existing.Locale && (declared.Strength == 0 || declared.Strength == existing.Strength)
+}
+
+// Model returns the driver index model creating the index.
+func (spec IndexSpec) Model() mongo.IndexModel {
+	opts := options.Index().SetName(spec.indexName())
+	if spec.Unique {
+		opts.SetUnique(true)
+	}
+	if spec.Sparse {
+		opts.SetSparse(true)
+	}
+	if len(spec.PartialFilter) > 0 {
+		opts.SetPartialFilterExpression(spec.PartialFilter)
+	}
+	if spec.ExpireAfter > 0 {
+		opts.SetExpireAfterSeconds(int32(spec.ExpireAfter / time.Second))
+	}
+	if spec.Collation != nil {
+		opts.SetCollation(spec.Collation)
+	}
+	if len(spec.Weights) > 0 {
+		opts.SetWeights(spec.Weights)
+	}
+	if spec.DefaultLanguage != "" {
+		opts.SetDefaultLanguage(spec.DefaultLanguage)
+	}
+	return mongo.IndexModel{Keys: spec.Keys, Options: opts}
+}
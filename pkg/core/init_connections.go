@@ -1,65 +1,56 @@
 package core
 
-import (
-	"log"
-	"reflect"
-
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
-)
-
-var dbConnectionMap map[string]Db = make(map[string]Db)
-
 // Since we all pool of connection per db in db map.
 // use this this method if needed secondary connection for specific db name.
 func SecondaryConnectionByName(dbName string) *DBConnection {
-	dbOptions := options.Database().SetReadPreference(readpref.SecondaryPreferred())
-	return &DBConnection{DB: dbConnectionMap[dbName].Client.Database(dbConnectionMap[dbName].Config.DBName, dbOptions)}
+	return defaultRegistry.SecondaryConnectionByName(dbName)
 }
 
-// Will return the only db secondary connection.
-// if your app is connected to multiple mongodb, then please use SecondaryConnectionByName
+// Will return the default db secondary connection, or the only one if your app is connected to single mongodb.
+// if your app is connected to multiple mongodb without a default, then please use SecondaryConnectionByName
 // this will return nil
 func SecondaryConnection() *DBConnection {
-	if len(dbConnectionMap) == 1 {
-		keys := reflect.ValueOf(dbConnectionMap).MapKeys()
-		dbConnection := dbConnectionMap[keys[0].String()]
-		dbOptions := options.Database().SetReadPreference(readpref.SecondaryPreferred())
-		return &DBConnection{DB: dbConnection.Client.Database(dbConnection.Config.DBName, dbOptions)}
-	}
-	return nil
+	return defaultRegistry.SecondaryConnection()
+}
+
+// Lookup returns the connection for the given database name from the default registry, or an error matching
+// ErrUnknownDatabase when it is not registered.
+func Lookup(dbName string) (*DBConnection, error) {
+	return defaultRegistry.Lookup(dbName)
+}
+
+// MustLookup is like Lookup but panics when the database is not registered.
+func MustLookup(dbName string) *DBConnection {
+	return defaultRegistry.MustLookup(dbName)
 }
 
-// Will return connection by db name from connection map.
+// SetDefault sets the database returned by Connection and SecondaryConnection.
+func SetDefault(dbName string) {
+	defaultRegistry.SetDefault(dbName)
+}
+
+// Will return connection by db name from connection map, nil if it's not registered. Use Lookup to get an error.
 func ConnectionByName(dbName string) *DBConnection {
-	return &DBConnection{DB: dbConnectionMap[dbName].Client.Database(dbConnectionMap[dbName].Config.DBName)}
+	return defaultRegistry.ConnectionByName(dbName)
 }
 
-// Will return the only connection by name or if your app is connected to single mongodb.
-// if your app is connected to multiple mongodb, then please use ConnectionByName this will return nil
+// Will return the default connection set with SetDefault, or the only connection if your app is connected to
+// single mongodb. if your app is connected to multiple mongodb without a default, this will return nil
 func Connection() *DBConnection {
-	if len(dbConnectionMap) == 1 {
-		keys := reflect.ValueOf(dbConnectionMap).MapKeys()
-		dbConnection := dbConnectionMap[keys[0].String()]
-		return &DBConnection{DB: dbConnection.Client.Database(dbConnection.Config.DBName)}
-	}
-	return nil
+	return defaultRegistry.Connection()
+}
+
+// SetLogger sets the logger used by the default registry and its connections.
+func SetLogger(logger Logger) {
+	defaultRegistry.SetLogger(logger)
 }
 
 // Set up mongodb with provided vargs of configs.
 func SetupMongoDB(configs ...DBConfig) error {
-	for _, config := range configs {
-		if err := Setup(config); err != nil {
-			log.Fatalf("Error setting up data layer : %s %+v.\n", err, config)
-			return err
-		}
-
-		newPdb, err := Get(config.DBName)
-		if err != nil {
-			log.Fatalf("DB connection error : %s.\n", err)
-		}
-		dbConnectionMap[config.DBName] = newPdb
-	}
+	return defaultRegistry.SetupMongoDB(configs...)
+}
 
-	return nil
+// ConnectionWith returns a connection for the given database name reading with the given read preference.
+func ConnectionWith(dbName string, pref ReadPref) (*DBConnection, error) {
+	return defaultRegistry.ConnectionWith(dbName, pref)
 }
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DecodeError is returned when a document read from a cursor cannot be decoded. ID is the _id of the offending
+// document, nil when it has none.
+type DecodeError struct {
+	ID  interface{}
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding document with _id %v: %s", e.ID, e.Err)
+}
+
+// Unwrap returns the decoding error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Iterator decodes the documents of a cursor into T one at a time, so large results are never held in memory
+// at once:
+//
+//	it, err := core.Iterate[*Order](ctx, conn, query, core.CursorOptions{BatchSize: 500})
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close(ctx)
+//	for it.Next(ctx) {
+//		process(it.Value())
+//	}
+//	return it.Err()
+//
+// The cursor is closed once it is exhausted or an error occurs; calling Close is still needed when the loop
+// stops early.
+type Iterator[T any] struct {
+	cursor  *mongo.Cursor
+	current T
+	err     error
+	closed  bool
+}
+
+// NewIterator creates an iterator decoding the documents of the given cursor.
+func NewIterator[T any](cursor *mongo.Cursor) *Iterator[T] {
+	return &Iterator[T]{cursor: cursor}
+}
+
+// Next decodes the next document, making it available through Value. It returns false when the cursor is
+// exhausted or an error occurred, see Err.
+func (it *Iterator[T]) Next(ctx context.Context) bool {
+	if it.closed || it.err != nil {
+		return false
+	}
+	if !it.cursor.Next(ctx) {
+		it.err = it.cursor.Err()
+		it.Close(ctx)
+		return false
+	}
+
+	document := newDocument[T]()
+	if err := it.cursor.Decode(decodeTarget(&document)); err != nil {
+		it.err = &DecodeError{ID: documentID(it.cursor.Current), Err: err}
+		it.Close(ctx)
+		return false
+	}
+	it.current = document
+	return true
+}
+
+// Value returns the document decoded by the last call to Next.
+func (it *Iterator[T]) Value() T {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, nil when the cursor was exhausted.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Close closes the cursor. It is safe to call several times.
+func (it *Iterator[T]) Close(ctx context.Context) error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	return it.cursor.Close(ctx)
+}
+
+// Iterate returns an iterator over the documents of type T matching the query.
+func Iterate[T Document](ctx context.Context, conn *DBConnection, query Q, cursorOptions CursorOptions) (*Iterator[T], error) {
+	cursor, err := conn.GetCursor(ctx, query, newDocument[T]().CollectionName(), cursorOptions)
+	if err != nil {
+		return nil, err
+	}
+	return NewIterator[T](cursor), nil
+}
+
+// Each calls fn with every document of type T matching the query, decoding one document at a time. It stops at
+// the first error returned by fn, which it returns, and always closes the cursor.
+func Each[T Document](ctx context.Context, conn *DBConnection, query Q, cursorOptions CursorOptions, fn func(T) error) error {
+	it, err := Iterate[T](ctx, conn, query, cursorOptions)
+	if err != nil {
+		return err
+	}
+	return each(ctx, it, fn)
+}
+
+// each calls fn with every document of the iterator and closes it.
+func each[T any](ctx context.Context, it *Iterator[T], fn func(T) error) error {
+	defer it.Close(ctx)
+	for it.Next(ctx) {
+		if err := fn(it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// Iterate returns an iterator over the documents matching the query.
+func (r *Repository[T]) Iterate(ctx context.Context, query Q, cursorOptions CursorOptions) (*Iterator[T], error) {
+	return Iterate[T](ctx, r.conn, query, cursorOptions)
+}
+
+// Each calls fn with every document matching the query, decoding one document at a time.
+func (r *Repository[T]) Each(ctx context.Context, query Q, cursorOptions CursorOptions, fn func(T) error) error {
+	return Each[T](ctx, r.conn, query, cursorOptions, fn)
+}
+
+// findOptions returns the find options for the cursor options, leaving zero values unset. Other values are
+// forwarded as is, e.g. a negative Limit returns a single batch.
+func (c CursorOptions) findOptions() *options.FindOptions {
+	opts := options.Find()
+	if c.BatchSize != 0 {
+		opts.SetBatchSize(c.BatchSize)
+	}
+	if c.Limit != 0 {
+		opts.SetLimit(c.Limit)
+	}
+	if c.Skip != 0 {
+		opts.SetSkip(c.Skip)
+	}
+	if c.Sort != nil {
+		opts.SetSort(c.Sort)
+	}
+	return opts
+}
+
+// documentID returns the _id of a raw document, nil when it has none.
+func documentID(document bson.Raw) interface{} {
+	value, err := document.LookupErr("_id")
+	if err != nil {
+		return nil
+	}
+	var id interface{}
+	if err := value.Unmarshal(&id); err != nil {
+		return value.String()
+	}
+	return id
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// Logger receives the log output of pmongo. The args are alternating key/value pairs, as with log/slog, so a
+// *slog.Logger satisfies the interface directly.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// defaultLogger writes through the standard log package, which is what pmongo has always done.
+var defaultLogger Logger = stdLogger{}
+
+// NewSlogLogger returns a Logger writing to the given slog logger, or to slog.Default() when nil.
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
+
+// NopLogger returns a Logger discarding everything.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+// stdLogger writes to the standard log package, formatting the args as key=value pairs. Debug messages are
+// dropped.
+type stdLogger struct{}
+
+func (stdLogger) Debug(string, ...any) {}
+
+func (l stdLogger) Info(msg string, args ...any) { l.print("INFO", msg, args) }
+
+func (l stdLogger) Warn(msg string, args ...any) { l.print("WARN", msg, args) }
+
+func (l stdLogger) Error(msg string, args ...any) { l.print("ERROR", msg, args) }
+
+func (stdLogger) print(level, msg string, args []any) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+	log.Print(b.String())
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+
+func (nopLogger) Info(string, ...any) {}
+
+func (nopLogger) Warn(string, ...any) {}
+
+func (nopLogger) Error(string, ...any) {}
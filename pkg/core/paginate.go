@@ -0,0 +1,324 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultPageSize is the page size used when a page request does not set one.
+const DefaultPageSize = 20
+
+// ErrInvalidPageToken is returned for page tokens that were not issued by Paginate with the current key, were
+// tampered with, or were issued for a different sort.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+var pageTokenKey = struct {
+	sync.RWMutex
+	key []byte
+}{key: randomKey()}
+
+// SetPageTokenKey sets the key page tokens are signed with. It defaults to a random key, so tokens are only
+// valid within the process that issued them: set a shared secret when several instances serve the same list.
+func SetPageTokenKey(key []byte) {
+	pageTokenKey.Lock()
+	defer pageTokenKey.Unlock()
+	pageTokenKey.key = append([]byte(nil), key...)
+}
+
+// randomKey returns a random 32 bytes key.
+func randomKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("pmongo: generating page token key: " + err.Error())
+	}
+	return key
+}
+
+// SortField is a field of a sort spec, see Asc and Desc.
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// Asc sorts by the field in ascending order.
+func Asc[F ~string](field F) SortField {
+	return SortField{Field: string(field)}
+}
+
+// Desc sorts by the field in descending order.
+func Desc[F ~string](field F) SortField {
+	return SortField{Field: string(field), Descending: true}
+}
+
+// PageRequest asks Paginate for a page of Limit documents in the order of Sort, starting from Token, the Next or
+// Previous token of a page, or from the first document when empty. _id is appended to the sort as a tiebreaker
+// unless it already is part of it, so that every document has a unique position.
+type PageRequest struct {
+	Sort  []SortField
+	Limit int64
+	Token string
+}
+
+// Page is a page of documents returned by Paginate. Next and Previous are the tokens of the following and
+// preceding pages, empty when there are none.
+type Page[T any] struct {
+	Items    []T
+	Next     string
+	Previous string
+}
+
+// OffsetPage is a page of documents returned by PaginateOffset. Page numbers start at 1.
+type OffsetPage[T any] struct {
+	Items    []T
+	Page     int64
+	PageSize int64
+	Total    int64
+	Pages    int64
+}
+
+// pageToken is the signed content of a page token: the sort values of the document the page starts after, or
+// ends before when Backward is set, and the sort spec they belong to.
+type pageToken struct {
+	Sort     string          `bson:"s"`
+	Backward bool            `bson:"b,omitempty"`
+	Values   []bson.RawValue `bson:"v"`
+}
+
+// Paginate returns a page of the documents of type T matching the query, using keyset pagination: pages are
+// fetched from the position a token points at with an index friendly range query, instead of skipping the
+// preceding documents. The sort fields should be covered by an index and present in every document.
+//
+//	page, err := core.Paginate[*Order](ctx, conn, query, core.PageRequest{Sort: []core.SortField{core.Desc("createdDate")}, Limit: 50})
+//	next, err := core.Paginate[*Order](ctx, conn, query, core.PageRequest{Sort: sort, Limit: 50, Token: page.Next})
+func Paginate[T Document](ctx context.Context, conn *DBConnection, query Q, req PageRequest) (Page[T], error) {
+	ctx = conn.context(ctx)
+	sort := withIDTiebreaker(req.Sort)
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+
+	var token *pageToken
+	if req.Token != "" {
+		var err error
+		if token, err = decodePageToken(req.Token, sort); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	backward := token != nil && token.Backward
+
+	filter := query
+	if token != nil {
+		filter = query.And(keysetCondition(sort, token.Values, backward))
+	}
+	opts := options.Find().SetSort(sortD(sort, backward)).SetLimit(limit + 1)
+	cursor, err := conn.Collection(newDocument[T]().CollectionName()).Find(ctx, filter, opts)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	// The raw documents are kept to read the sort values of the first and last ones into the tokens.
+	var items []T
+	var raws []bson.Raw
+	defer cursor.Close(ctx)
+	for int64(len(items)) < limit && cursor.Next(ctx) {
+		document := newDocument[T]()
+		if err := cursor.Decode(decodeTarget(&document)); err != nil {
+			return Page[T]{}, &DecodeError{ID: documentID(cursor.Current), Err: err}
+		}
+		items = append(items, document)
+		raws = append(raws, append(bson.Raw(nil), cursor.Current...))
+	}
+	more := cursor.Next(ctx)
+	if err := cursor.Err(); err != nil {
+		return Page[T]{}, err
+	}
+	if backward {
+		slices.Reverse(items)
+		slices.Reverse(raws)
+	}
+
+	page := Page[T]{Items: items}
+	if len(raws) == 0 {
+		return page, nil
+	}
+	// Going forward there is a previous page when we started from a token, and a next one when more documents
+	// followed; going backward the other way around.
+	hasNext, hasPrevious := more, token != nil
+	if backward {
+		hasNext, hasPrevious = true, more
+	}
+	if hasNext {
+		if page.Next, err = encodePageToken(sort, raws[len(raws)-1], false); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	if hasPrevious {
+		if page.Previous, err = encodePageToken(sort, raws[0], true); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	return page, nil
+}
+
+// PaginateOffset returns the page of pageSize documents of type T matching the query, along with the total
+// number of matching documents. Deep pages get slower as the skipped documents are still scanned: prefer
+// Paginate for lists that are browsed page after page.
+func PaginateOffset[T Document](ctx context.Context, conn *DBConnection, query Q, sort []SortField, page, pageSize int64) (OffsetPage[T], error) {
+	ctx = conn.context(ctx)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	coll := conn.Collection(newDocument[T]().CollectionName())
+	total, err := coll.CountDocuments(ctx, query)
+	if err != nil {
+		return OffsetPage[T]{}, err
+	}
+
+	opts := options.Find().SetSort(sortD(withIDTiebreaker(sort), false)).SetSkip((page - 1) * pageSize).SetLimit(pageSize)
+	cursor, err := coll.Find(ctx, query, opts)
+	if err != nil {
+		return OffsetPage[T]{}, err
+	}
+	items := make([]T, 0, pageSize)
+	if err := each(ctx, NewIterator[T](cursor), func(document T) error {
+		items = append(items, document)
+		return nil
+	}); err != nil {
+		return OffsetPage[T]{}, err
+	}
+	return OffsetPage[T]{Items: items, Page: page, PageSize: pageSize, Total: total, Pages: (total + pageSize - 1) / pageSize}, nil
+}
+
+// Paginate returns a page of the documents matching the query, see Paginate.
+func (r *Repository[T]) Paginate(ctx context.Context, query Q, req PageRequest) (Page[T], error) {
+	return Paginate[T](ctx, r.conn, query, req)
+}
+
+// PaginateOffset returns the page of the documents matching the query along with their total number, see
+// PaginateOffset.
+func (r *Repository[T]) PaginateOffset(ctx context.Context, query Q, sort []SortField, page, pageSize int64) (OffsetPage[T], error) {
+	return PaginateOffset[T](ctx, r.conn, query, sort, page, pageSize)
+}
+
+// withIDTiebreaker returns the sort with _id appended unless it is already part of it.
+func withIDTiebreaker(sort []SortField) []SortField {
+	for _, field := range sort {
+		if field.Field == "_id" {
+			return sort
+		}
+	}
+	return append(append([]SortField(nil), sort...), Asc("_id"))
+}
+
+// sortD renders the sort, reversed when backward is set.
+func sortD(sort []SortField, backward bool) bson.D {
+	d := make(bson.D, 0, len(sort))
+	for _, field := range sort {
+		direction := 1
+		if field.Descending != backward {
+			direction = -1
+		}
+		d = append(d, bson.E{Key: field.Field, Value: direction})
+	}
+	return d
+}
+
+// sortSpec identifies the sort a token was issued for.
+func sortSpec(sort []SortField) string {
+	fields := make([]string, 0, len(sort))
+	for _, field := range sort {
+		if field.Descending {
+			fields = append(fields, "-"+field.Field)
+		} else {
+			fields = append(fields, field.Field)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// keysetCondition matches the documents sorted after the given values, or before them when backward is set:
+// those greater on the first field, or equal on it and greater on the second one, and so on.
+func keysetCondition(sort []SortField, values []bson.RawValue, backward bool) Q {
+	conditions := make([]Q, 0, len(sort))
+	for i, field := range sort {
+		equal := make([]Q, 0, i+1)
+		for j := 0; j < i; j++ {
+			equal = append(equal, Where(sort[j].Field).Eq(values[j]))
+		}
+		if field.Descending != backward {
+			equal = append(equal, Where(field.Field).Lt(values[i]))
+		} else {
+			equal = append(equal, Where(field.Field).Gt(values[i]))
+		}
+		conditions = append(conditions, And(equal...))
+	}
+	return Or(conditions...)
+}
+
+// encodePageToken returns the signed token pointing at the document.
+func encodePageToken(sort []SortField, document bson.Raw, backward bool) (string, error) {
+	token := pageToken{Sort: sortSpec(sort), Backward: backward, Values: make([]bson.RawValue, 0, len(sort))}
+	for _, field := range sort {
+		value, err := document.LookupErr(strings.Split(field.Field, ".")...)
+		if err != nil {
+			// Documents missing a sort field sort as null.
+			value = bson.RawValue{Type: bson.TypeNull}
+		}
+		token.Values = append(token.Values, value)
+	}
+	payload, err := bson.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawURLEncoding
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(signPageToken(payload)), nil
+}
+
+// decodePageToken verifies the token and returns its content, which must match the sort.
+func decodePageToken(s string, sort []SortField) (*pageToken, error) {
+	encoding := base64.RawURLEncoding
+	encodedPayload, encodedSignature, ok := strings.Cut(s, ".")
+	if !ok {
+		return nil, ErrInvalidPageToken
+	}
+	payload, err := encoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	signature, err := encoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, signPageToken(payload)) {
+		return nil, ErrInvalidPageToken
+	}
+
+	var token pageToken
+	if err := bson.Unmarshal(payload, &token); err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	if token.Sort != sortSpec(sort) || len(token.Values) != len(sort) {
+		return nil, ErrInvalidPageToken
+	}
+	return &token, nil
+}
+
+// signPageToken returns the HMAC-SHA256 of the token payload.
+func signPageToken(payload []byte) []byte {
+	pageTokenKey.RLock()
+	mac := hmac.New(sha256.New, pageTokenKey.key)
+	pageTokenKey.RUnlock()
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
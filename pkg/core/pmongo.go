@@ -3,9 +3,7 @@ package core
 import (
 	"context"
 	"errors"
-	"log"
 	"reflect"
-	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,21 +14,23 @@ import (
 // Q query representation to hide bson.M type to single file
 type Q map[string]interface{}
 
-// connectionMap holds all the db connection per database name
-var connectionMap = make(map[string]Db)
-
 // Get creates new database connection
 func Get(dbName string) (Db, error) {
-	if db, ok := connectionMap[dbName]; ok {
+	if db, ok := defaultRegistry.Get(dbName); ok {
 		return db, nil
 	}
-	return Db{}, errors.New("database connection not available. Perform 'Setup' first")
+	return Db{}, &UnknownDatabaseError{Name: dbName}
 }
 
 // DB represents database connection which holds reference to global client and configuration for that database.
 type Db struct {
 	Config DBConfig
 	Client *mongo.Client
+
+	// ops tracks the commands in flight on Client so Close can drain them.
+	ops *opTracker
+	// shared is set when Client is shared with the other databases of the same cluster.
+	shared *sharedClient
 }
 
 // CursorOptions represents options for querying a database cursor.
@@ -47,35 +47,51 @@ var ErrNoDocumentsFound = errors.New("mongo: no documents in result").Error()
 // Setup the MongoDB connection based on passed in config. It can be called multiple times to setup connection to
 // multiple MongoDB instances.
 func Setup(dbConfig DBConfig) error {
-	if dbConfig.HostURL == "" || dbConfig.DBName == "" {
-		return errors.New("invalid connection info. Missing host and db info")
-	}
+	return defaultRegistry.Setup(dbConfig)
+}
 
-	client, err := mongo.NewClient(options.Client().ApplyURI(dbConfig.HostURL))
-	if err != nil {
+// Setup the MongoDB connection based on passed in config and registers it. It can be called multiple times to
+// setup connection to multiple MongoDB instances.
+func (r *Registry) Setup(dbConfig DBConfig) error {
+	// Validate every config, as those sharing an existing client skip building client options.
+	if err := dbConfig.Validate(); err != nil {
+		r.Logger().Error("MongoDB connection failed", "db", dbConfig.Name(), "error", err)
 		return err
 	}
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-	err = client.Connect(ctx)
+	// Databases living on the same cluster with the same client options share one client and its pool.
+	shared, err := r.acquireClient(dbConfig)
 	if err != nil {
-		log.Printf("MongoDB %s connection failed : %s. Exiting the program.\n", dbConfig.DBName, err)
+		r.Logger().Error("MongoDB connection failed", "db", dbConfig.Name(), "error", err)
+		return err
+	}
+	db := Db{Config: dbConfig, Client: shared.client, ops: shared.ops, shared: shared}
+
+	if dbConfig.Lazy {
+		r.Register(db)
+		r.Logger().Info("Registered via pmongo, connecting on first use", "db", dbConfig.Name())
+		return nil
+	}
+
+	if err := r.connectWithRetry(db); err != nil {
+		r.mu.Lock()
+		last := r.releaseLocked(db)
+		r.mu.Unlock()
+		if last {
+			ctx, cancel := context.WithTimeout(context.Background(), dbConfig.connectTimeout())
+			defer cancel()
+			db.close(ctx)
+		}
+		r.Logger().Error("MongoDB connection failed", "db", dbConfig.Name(), "error", err)
 		return err
 	}
 
-	//starting with primary preferred, but individual query can change mode per copied session
-	log.Printf("Connected to %s via pmongo successfully", dbConfig.DBName)
+	r.Logger().Info("Connected via pmongo successfully", "db", dbConfig.Name())
 
 	/* Initialized database object with global database connection*/
-	connectionMap[dbConfig.DBName] = Db{Config: dbConfig, Client: client}
+	r.Register(db)
 	return nil
 }
 
-// DBConfig represents the configuration parameters needed for a MongoDB connection.
-type DBConfig struct {
-	HostURL, DBName string
-	Mode            int
-}
-
 // Document interface implemented by structs that needs to be persisted. It should provide collection name,
 // as in the database. Also, a way to create new object id before saving.
 type Document interface {
@@ -85,6 +101,23 @@ type Document interface {
 // DBConnection pmongo connection wrapper
 type DBConnection struct {
 	DB *mongo.Database
+
+	logger Logger
+	// session is set on the connections given to WithTransaction callbacks, see context.
+	session mongo.Session
+}
+
+// log returns the logger of the registry the connection came from, or the default logger.
+func (s *DBConnection) log() Logger {
+	if s.logger == nil {
+		return defaultLogger
+	}
+	return s.logger
+}
+
+// Logger returns the logger of the registry the connection came from, for packages built on top of pmongo.
+func (s *DBConnection) Logger() Logger {
+	return s.log()
 }
 
 // collection returns a mgo.collection representation for given collection name and session
@@ -94,6 +127,7 @@ func (s *DBConnection) Collection(collectionName string) *mongo.Collection {
 
 // Save inserts the given document that represents the collection to the database.
 func (s *DBConnection) Save(ctx context.Context, document Document) error {
+	ctx = s.context(ctx)
 	coll := s.Collection(document.CollectionName())
 	_, err := coll.InsertOne(ctx, document)
 	return err
@@ -101,6 +135,7 @@ func (s *DBConnection) Save(ctx context.Context, document Document) error {
 
 // Update updates the given document based on given selector
 func (s *DBConnection) Update(ctx context.Context, selector Q, document Document) error {
+	ctx = s.context(ctx)
 	coll := s.Collection(document.CollectionName())
 	//_, err := coll.UpdateOne(ctx, selector, bson.M{"$set": document})
 	_, err := coll.ReplaceOne(ctx, selector, document)
@@ -109,6 +144,7 @@ func (s *DBConnection) Update(ctx context.Context, selector Q, document Document
 
 // Update updates the given document based on given selector
 func (s *DBConnection) Upsert(ctx context.Context, selector Q, document Document) error {
+	ctx = s.context(ctx)
 	coll := s.Collection(document.CollectionName())
 	//_, err := coll.UpdateOne(ctx, selector, bson.M{"$set": document})
 	_, err := coll.ReplaceOne(ctx, selector, document, options.Replace().SetUpsert(true))
@@ -136,10 +172,11 @@ func (s *DBConnection) FindByID(ctx context.Context, id string, result Document)
 
 // Find the data based on given query
 func (s *DBConnection) Find(ctx context.Context, query Q, document Document) error {
+	ctx = s.context(ctx)
 	err := s.Collection(document.CollectionName()).FindOne(ctx, query).Decode(document)
 	if err != nil {
 		if err.Error() != mongo.ErrNoDocuments.Error() {
-			log.Printf("Error fetching %s with query %s. Error: %s\n", document.CollectionName(), query, err)
+			s.log().Error("Error fetching document", "collection", document.CollectionName(), "query", query, "error", err)
 		}
 	}
 	return err
@@ -147,10 +184,11 @@ func (s *DBConnection) Find(ctx context.Context, query Q, document Document) err
 
 // FindWithOpts finds the data based on the given query with specified find options.
 func (s *DBConnection) FindWithOpts(ctx context.Context, query Q, document Document, opts *options.FindOneOptions) error {
+	ctx = s.context(ctx)
 	err := s.Collection(document.CollectionName()).FindOne(ctx, query, opts).Decode(document)
 	if err != nil {
 		if err.Error() != mongo.ErrNoDocuments.Error() {
-			log.Printf("Error fetching %s with query %s. Error: %s\n", document.CollectionName(), query, err)
+			s.log().Error("Error fetching document", "collection", document.CollectionName(), "query", query, "error", err)
 		}
 	}
 	return err
@@ -158,6 +196,7 @@ func (s *DBConnection) FindWithOpts(ctx context.Context, query Q, document Docum
 
 // FindAll returns all the documents based on given query
 func (s *DBConnection) FindAll(ctx context.Context, query Q, document Document) (interface{}, error) {
+	ctx = s.context(ctx)
 	curr, err := s.Collection(document.CollectionName()).Find(ctx, query)
 	if err != nil {
 		return nil, err
@@ -172,6 +211,7 @@ func (s *DBConnection) FindAll(ctx context.Context, query Q, document Document)
 
 // FindAllWithOpts returns all the documents based on given query & find options
 func (s *DBConnection) FindAllWithOpts(ctx context.Context, query Q, document Document, opts *options.FindOptions) (interface{}, error) {
+	ctx = s.context(ctx)
 	curr, err := s.Collection(document.CollectionName()).Find(ctx, query, opts)
 	if err != nil {
 		return nil, err
@@ -198,11 +238,14 @@ func slice(d Document) interface{} {
 	return reflect.New(documentSlice.Type()).Interface()
 }
 
-// Exists check if the document exists for given query
+// Exists check if the document exists for given query. Only the _id of the first match is fetched, the
+// document is used for its collection name and left untouched.
 func (s *DBConnection) Exists(ctx context.Context, query Q, document Document) (bool, error) {
-	err := s.Find(ctx, query, document)
+	ctx = s.context(ctx)
+	opts := options.FindOne().SetProjection(Q{"_id": 1})
+	err := s.Collection(document.CollectionName()).FindOne(ctx, query, opts).Err()
 	if err != nil {
-		if err.Error() == mongo.ErrNoDocuments.Error() {
+		if errors.Is(err, mongo.ErrNoDocuments) {
 			return false, nil
 		}
 		return false, err
@@ -210,8 +253,28 @@ func (s *DBConnection) Exists(ctx context.Context, query Q, document Document) (
 	return true, nil
 }
 
+// Count returns the number of documents matching the query
+func (s *DBConnection) Count(ctx context.Context, query Q, document Document) (int64, error) {
+	return s.CountWithOpts(ctx, query, document, nil)
+}
+
+// CountWithOpts returns the number of documents matching the query with the given count options, e.g. a limit,
+// skip or index hint
+func (s *DBConnection) CountWithOpts(ctx context.Context, query Q, document Document, opts *options.CountOptions) (int64, error) {
+	ctx = s.context(ctx)
+	return s.Collection(document.CollectionName()).CountDocuments(ctx, query, opts)
+}
+
+// EstimatedCount returns the number of documents in the collection from its metadata, without scanning it. The
+// count can be off after unclean shutdowns or with orphaned documents on sharded clusters.
+func (s *DBConnection) EstimatedCount(ctx context.Context, document Document) (int64, error) {
+	ctx = s.context(ctx)
+	return s.Collection(document.CollectionName()).EstimatedDocumentCount(ctx)
+}
+
 // Remove removes the given document type based on the query
 func (s *DBConnection) Remove(ctx context.Context, query Q, document Document) error {
+	ctx = s.context(ctx)
 	_, err := s.Collection(document.CollectionName()).DeleteOne(ctx, query)
 	return err
 }
@@ -228,12 +291,14 @@ func (s *DBConnection) RemoveByID(ctx context.Context, id string, result Documen
 
 // RemoveAll removes all the document matching given selector query
 func (s *DBConnection) RemoveAll(ctx context.Context, query Q, document Document) error {
+	ctx = s.context(ctx)
 	_, err := s.Collection(document.CollectionName()).DeleteMany(ctx, query)
 	return err
 }
 
 // RemoveAllWithCount removes all the document matching given selector query
 func (s *DBConnection) RemoveAllWithCount(ctx context.Context, query Q, document Document) (int64, error) {
+	ctx = s.context(ctx)
 	res, err := s.Collection(document.CollectionName()).DeleteMany(ctx, query)
 	if res == nil {
 		return -1, err
@@ -243,18 +308,13 @@ func (s *DBConnection) RemoveAllWithCount(ctx context.Context, query Q, document
 
 // GetCursor gets a cursor to iterate over the documents returned by the selector
 func (s *DBConnection) GetCursor(ctx context.Context, query Q, collectionName string, cursorOptions CursorOptions) (*mongo.Cursor, error) {
-	opts := &options.FindOptions{
-		BatchSize: &cursorOptions.BatchSize,
-		Skip:      &cursorOptions.Skip,
-		Sort:      cursorOptions.Sort,
-		Limit:     &cursorOptions.Limit,
-	}
-
-	return s.Collection(collectionName).Find(ctx, query, opts)
+	ctx = s.context(ctx)
+	return s.Collection(collectionName).Find(ctx, query, cursorOptions.findOptions())
 }
 
 // UpdateFieldValue updates the single field with a given value for a collection name based query
 func (s *DBConnection) UpdateFieldValue(ctx context.Context, query Q, collectionName, field string, value interface{}) error {
+	ctx = s.context(ctx)
 	_, err := s.Collection(collectionName).UpdateOne(ctx, query, bson.M{"$set": bson.M{field: value}})
 
 	return err
@@ -263,6 +323,7 @@ func (s *DBConnection) UpdateFieldValue(ctx context.Context, query Q, collection
 // ConditionalUpdateField atomically updates a single field only when the document matches the given
 // query. Returns true if the document was matched and updated, false if nothing matched.
 func (s *DBConnection) ConditionalUpdateField(ctx context.Context, query Q, collectionName, field string, value interface{}) (bool, error) {
+	ctx = s.context(ctx)
 	result, err := s.Collection(collectionName).UpdateOne(ctx, query, bson.M{"$set": bson.M{field: value}})
 	if err != nil {
 		return false, err
@@ -272,6 +333,7 @@ func (s *DBConnection) ConditionalUpdateField(ctx context.Context, query Q, coll
 
 // InsertMany inserts multiple documents into a collection.
 func (s *DBConnection) InsertMany(ctx context.Context, collectionName string, documents []interface{}) error {
+	ctx = s.context(ctx)
 	_, err := s.Collection(collectionName).InsertMany(ctx, documents)
 	if err != nil {
 		return err
@@ -282,6 +344,7 @@ func (s *DBConnection) InsertMany(ctx context.Context, collectionName string, do
 
 // FindLastestDocument finds the latest entry in the collection, sorted by ID.
 func (s *DBConnection) FindLastestDocument(ctx context.Context, query Q, document Document) error {
+	ctx = s.context(ctx)
 	opts := &options.FindOneOptions{
 		Sort: map[string]int{"_id": -1},
 	}
@@ -338,6 +401,7 @@ func (s *DBConnection) BulkWriteAddUpdate(ctx context.Context, collectionName st
 //   fmt.Println(result)
 
 func (s *DBConnection) Unique(ctx context.Context, fieldName string, query interface{}, document Document) ([]interface{}, error) {
+	ctx = s.context(ctx)
 	result, err := s.Collection(document.CollectionName()).Distinct(ctx, fieldName, query)
 	if err != nil {
 		return nil, err
@@ -347,6 +411,7 @@ func (s *DBConnection) Unique(ctx context.Context, fieldName string, query inter
 
 // Sort by ID and Find first entry in the collection
 func (s *DBConnection) FindFirstDocument(ctx context.Context, query Q, document Document) error {
+	ctx = s.context(ctx)
 	opts := &options.FindOneOptions{
 		Sort: map[string]int{"_id": 1},
 	}
@@ -361,6 +426,7 @@ func (s *DBConnection) FindFirstDocument(ctx context.Context, query Q, document
 
 // UpdateManyUsingQuery updates the field(s) based on the update query of the documents given by selector
 func (s *DBConnection) UpdateManyUsingQuery(ctx context.Context, selector Q, updateQuery Q, document Document) error {
+	ctx = s.context(ctx)
 	coll := s.Collection(document.CollectionName())
 	_, err := coll.UpdateMany(ctx, selector, updateQuery)
 	return err
@@ -378,6 +444,7 @@ func (s *DBConnection) FindByObjectIDs(ctx context.Context, oIDs []string, docum
 }
 
 func (s *DBConnection) bulkWriteUpdate(ctx context.Context, collectionName string, documents map[string]interface{}, upsert bool) error {
+	ctx = s.context(ctx)
 	if len(documents) == 0 {
 		return errors.New("no data to update")
 	}
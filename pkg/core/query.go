@@ -0,0 +1,314 @@
+package core
+
+import (
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Field builds conditions on a single field of a query. Every condition renders to a Q, so it can be passed to
+// any DBConnection method taking a query and combined with And, Or and Nor:
+//
+//	query := core.Where("status").Eq("active").And(core.Where("age").Gt(18))
+//	query = query.Or(core.Where("roles").All("admin"))
+type Field struct {
+	name string
+	not  bool
+}
+
+// Where starts a condition on the given field path, e.g. "address.city" or a constant generated by pmongo-gen
+// such as OrderAddressCity.
+func Where[F ~string](field F) Field {
+	return Field{name: string(field)}
+}
+
+// Not negates the next condition with $not, e.g. Where("age").Not().Gt(18).
+func (f Field) Not() Field {
+	f.not = !f.not
+	return f
+}
+
+// condition renders the operator expression for the field, wrapped in $not when negated.
+func (f Field) condition(expression Q) Q {
+	if f.not {
+		return Q{f.name: Q{"$not": expression}}
+	}
+	return Q{f.name: expression}
+}
+
+// op renders a single operator condition for the field.
+func (f Field) op(operator string, value interface{}) Q {
+	return f.condition(Q{operator: value})
+}
+
+// Eq matches documents where the field equals value.
+func (f Field) Eq(value interface{}) Q {
+	if f.not {
+		return f.op("$eq", value)
+	}
+	return Q{f.name: value}
+}
+
+// Ne matches documents where the field does not equal value.
+func (f Field) Ne(value interface{}) Q {
+	return f.op("$ne", value)
+}
+
+// Gt matches documents where the field is greater than value.
+func (f Field) Gt(value interface{}) Q {
+	return f.op("$gt", value)
+}
+
+// Gte matches documents where the field is greater than or equal to value.
+func (f Field) Gte(value interface{}) Q {
+	return f.op("$gte", value)
+}
+
+// Lt matches documents where the field is less than value.
+func (f Field) Lt(value interface{}) Q {
+	return f.op("$lt", value)
+}
+
+// Lte matches documents where the field is less than or equal to value.
+func (f Field) Lte(value interface{}) Q {
+	return f.op("$lte", value)
+}
+
+// Between matches documents where the field is in the inclusive range [min, max].
+func (f Field) Between(min, max interface{}) Q {
+	return f.condition(Q{"$gte": min, "$lte": max})
+}
+
+// In matches documents where the field equals any of the values.
+func (f Field) In(values ...interface{}) Q {
+	return f.op("$in", values)
+}
+
+// Nin matches documents where the field equals none of the values.
+func (f Field) Nin(values ...interface{}) Q {
+	return f.op("$nin", values)
+}
+
+// Exists matches documents that have the field when exists is true, or lack it otherwise.
+func (f Field) Exists(exists bool) Q {
+	return f.op("$exists", exists)
+}
+
+// Type matches documents where the field has one of the given BSON types, by alias ("string") or number.
+func (f Field) Type(types ...interface{}) Q {
+	if len(types) == 1 {
+		return f.op("$type", types[0])
+	}
+	return f.op("$type", types)
+}
+
+// All matches documents where the array field contains all the values.
+func (f Field) All(values ...interface{}) Q {
+	return f.op("$all", values)
+}
+
+// ElemMatch matches documents where an element of the array field matches all the conditions. Conditions on
+// the element fields are written with Where, conditions on scalar elements with Where(""). Conditions on the
+// same element field are merged, e.g. ElemMatch(Where("qty").Gt(1), Where("qty").Lt(5)), and combined with
+// $and when they cannot be.
+func (f Field) ElemMatch(conditions ...Q) Q {
+	match := Q{}
+	merged := true
+	for _, condition := range elementConditions(conditions) {
+		for key, value := range condition {
+			merged = mergeCondition(match, key, value) && merged
+		}
+	}
+	if !merged {
+		return f.op("$elemMatch", Q{"$and": elementConditions(conditions)})
+	}
+	return f.op("$elemMatch", match)
+}
+
+// elementConditions returns the conditions of ElemMatch with those on scalar elements, written with Where(""),
+// turned into operator expressions of the element itself.
+func elementConditions(conditions []Q) []Q {
+	result := make([]Q, 0, len(conditions))
+	for _, condition := range conditions {
+		if len(condition) == 0 {
+			continue
+		}
+		element := Q{}
+		for key, value := range condition {
+			if expression, ok := value.(Q); ok && key == "" {
+				for operator, operand := range expression {
+					element[operator] = operand
+				}
+				continue
+			}
+			element[key] = value
+		}
+		result = append(result, element)
+	}
+	return result
+}
+
+// mergeCondition adds the condition on key to the query, merging it with an existing one when both are operator
+// expressions on different operators. It reports false when the conditions cannot be merged.
+func mergeCondition(query Q, key string, value interface{}) bool {
+	existing, ok := query[key]
+	if !ok {
+		query[key] = value
+		return true
+	}
+	a, aok := operatorExpression(existing)
+	b, bok := operatorExpression(value)
+	if !aok || !bok {
+		return false
+	}
+	merged := make(Q, len(a)+len(b))
+	for operator, operand := range a {
+		merged[operator] = operand
+	}
+	for operator, operand := range b {
+		if _, ok := merged[operator]; ok {
+			return false
+		}
+		merged[operator] = operand
+	}
+	query[key] = merged
+	return true
+}
+
+// operatorExpression returns the value as a query when it only holds operators, such as {$gt: 1, $lt: 5}.
+func operatorExpression(value interface{}) (Q, bool) {
+	expression, ok := value.(Q)
+	if !ok || len(expression) == 0 {
+		return nil, false
+	}
+	for key := range expression {
+		if !strings.HasPrefix(key, "$") {
+			return nil, false
+		}
+	}
+	return expression, true
+}
+
+// Size matches documents where the array field has exactly n elements.
+func (f Field) Size(n int) Q {
+	return f.op("$size", n)
+}
+
+// Regex matches documents where the string field matches the pattern with the given options, e.g. "i".
+func (f Field) Regex(pattern, options string) Q {
+	return f.op("$regex", primitive.Regex{Pattern: pattern, Options: options})
+}
+
+// Mod matches documents where the field divided by divisor has the given remainder.
+func (f Field) Mod(divisor, remainder int64) Q {
+	return f.op("$mod", []int64{divisor, remainder})
+}
+
+// And matches documents matching all the conditions.
+func And(conditions ...Q) Q {
+	return logical("$and", conditions)
+}
+
+// Or matches documents matching any of the conditions.
+func Or(conditions ...Q) Q {
+	return logical("$or", conditions)
+}
+
+// Nor matches documents matching none of the conditions.
+func Nor(conditions ...Q) Q {
+	return logical("$nor", conditions)
+}
+
+// Expr matches documents for which the aggregation expression is true, e.g.
+// Expr(Q{"$gt": []interface{}{"$spent", "$budget"}}).
+func Expr(expression interface{}) Q {
+	return Q{"$expr": expression}
+}
+
+// Text matches documents for the text search, which requires a text index on the collection.
+func Text(search string) Q {
+	return Q{"$text": Q{"$search": search}}
+}
+
+// And combines the query with the conditions so that all must match.
+func (q Q) And(conditions ...Q) Q {
+	return logical("$and", append([]Q{q}, conditions...))
+}
+
+// Or combines the query with the conditions so that any must match.
+func (q Q) Or(conditions ...Q) Q {
+	return logical("$or", append([]Q{q}, conditions...))
+}
+
+// Nor combines the query with the conditions so that none must match.
+func (q Q) Nor(conditions ...Q) Q {
+	return logical("$nor", append([]Q{q}, conditions...))
+}
+
+// logical renders a logical operator over the conditions. Conditions that are themselves only the same
+// operator are flattened, so chained calls stay a single level deep. Empty conditions match every document: they
+// are dropped from $and but kept in $or and $nor, where they decide the result. The server rejects logical
+// operators over no condition, so without any, $and and $nor render an empty query matching every document and
+// $or a query matching none, so that e.g. RemoveAll with Or over an empty list removes nothing.
+func logical(operator string, conditions []Q) Q {
+	flattened := make([]Q, 0, len(conditions))
+	for _, condition := range conditions {
+		if len(condition) == 0 && operator == "$and" {
+			continue
+		}
+		if nested, ok := condition[operator].([]Q); ok && len(condition) == 1 && operator != "$nor" {
+			flattened = append(flattened, nested...)
+			continue
+		}
+		flattened = append(flattened, condition)
+	}
+	switch {
+	case len(flattened) == 0 && operator == "$or":
+		return Q{"$expr": false}
+	case len(flattened) == 0:
+		return Q{}
+	case len(flattened) == 1 && operator != "$nor":
+		return flattened[0]
+	}
+	return Q{operator: flattened}
+}
+
+// D renders the query as a bson.D with keys sorted at every level, for deterministic output such as logging or
+// comparing queries.
+func (q Q) D() bson.D {
+	keys := make([]string, 0, len(q))
+	for key := range q {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	d := make(bson.D, 0, len(q))
+	for _, key := range keys {
+		d = append(d, bson.E{Key: key, Value: toD(q[key])})
+	}
+	return d
+}
+
+// toD converts the queries nested in a value to bson.D.
+func toD(value interface{}) interface{} {
+	switch v := value.(type) {
+	case Q:
+		return v.D()
+	case map[string]interface{}:
+		return Q(v).D()
+	case []Q:
+		a := make(bson.A, 0, len(v))
+		for _, item := range v {
+			a = append(a, item.D())
+		}
+		return a
+	case []interface{}:
+		a := make(bson.A, 0, len(v))
+		for _, item := range v {
+			a = append(a, toD(item))
+		}
+		return a
+	}
+	return value
+}
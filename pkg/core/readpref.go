@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+// Mode is the read preference mode of a connection. The zero value, DefaultMode, leaves it to the connection
+// string.
+type Mode int
+
+// Read preference modes, see https://www.mongodb.com/docs/manual/core/read-preference/.
+const (
+	// DefaultMode reads with the read preference of the connection string, the primary when it sets none.
+	DefaultMode Mode = iota
+	PrimaryMode
+	PrimaryPreferredMode
+	SecondaryMode
+	SecondaryPreferredMode
+	NearestMode
+)
+
+// modeNames holds the connection string name of each mode.
+var modeNames = map[Mode]string{
+	PrimaryMode:            "primary",
+	PrimaryPreferredMode:   "primaryPreferred",
+	SecondaryMode:          "secondary",
+	SecondaryPreferredMode: "secondaryPreferred",
+	NearestMode:            "nearest",
+}
+
+// String returns the connection string name of the mode, e.g. secondaryPreferred, or "default" for DefaultMode.
+func (m Mode) String() string {
+	if m == DefaultMode {
+		return "default"
+	}
+	if name, ok := modeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ParseMode parses a mode from its connection string name, ignoring case.
+func ParseMode(s string) (Mode, error) {
+	for mode, name := range modeNames {
+		if strings.EqualFold(name, s) {
+			return mode, nil
+		}
+	}
+	return DefaultMode, fmt.Errorf("unknown read preference mode %q", s)
+}
+
+// driverMode returns the driver representation of the mode.
+func (m Mode) driverMode() (readpref.Mode, error) {
+	switch m {
+	case PrimaryMode:
+		return readpref.PrimaryMode, nil
+	case PrimaryPreferredMode:
+		return readpref.PrimaryPreferredMode, nil
+	case SecondaryMode:
+		return readpref.SecondaryMode, nil
+	case SecondaryPreferredMode:
+		return readpref.SecondaryPreferredMode, nil
+	case NearestMode:
+		return readpref.NearestMode, nil
+	}
+	return 0, fmt.Errorf("unknown read preference mode %d", int(m))
+}
+
+// ReadPref describes which replica set members a connection reads from. The zero value leaves it to the
+// connection string.
+type ReadPref struct {
+	Mode Mode
+	// TagSets restricts eligible members to those matching the first tag set that matches any member. Not
+	// allowed with PrimaryMode or DefaultMode.
+	TagSets []map[string]string
+	// MaxStaleness excludes secondaries lagging further behind the primary. It must be at least 90 seconds and
+	// is not allowed with PrimaryMode or DefaultMode.
+	MaxStaleness time.Duration
+}
+
+// isSet reports whether the read preference overrides the one of the connection string.
+func (p ReadPref) isSet() bool {
+	return p.Mode != DefaultMode || len(p.TagSets) > 0 || p.MaxStaleness != 0
+}
+
+// readPref validates the read preference and converts it to the driver representation, nil when it is not set
+// so that the read preference of the client applies.
+func (p ReadPref) readPref() (*readpref.ReadPref, error) {
+	if !p.isSet() {
+		return nil, nil
+	}
+	if p.Mode == DefaultMode {
+		return nil, fmt.Errorf("read preference tag sets and max staleness require a mode")
+	}
+	mode, err := p.Mode.driverMode()
+	if err != nil {
+		return nil, err
+	}
+	if p.Mode == PrimaryMode && (len(p.TagSets) > 0 || p.MaxStaleness != 0) {
+		return nil, fmt.Errorf("read preference mode primary does not support tag sets or max staleness")
+	}
+	if p.MaxStaleness != 0 && p.MaxStaleness < 90*time.Second {
+		return nil, fmt.Errorf("read preference max staleness must be at least 90s, got %s", p.MaxStaleness)
+	}
+
+	var opts []readpref.Option
+	if len(p.TagSets) > 0 {
+		opts = append(opts, readpref.WithTagSets(tagSets(p.TagSets)...))
+	}
+	if p.MaxStaleness != 0 {
+		opts = append(opts, readpref.WithMaxStaleness(p.MaxStaleness))
+	}
+	return readpref.New(mode, opts...)
+}
+
+// databaseOptions returns database options applying the read preference, none when it is not set so that the
+// database inherits the read preference of the client.
+func (p ReadPref) databaseOptions() (*options.DatabaseOptions, error) {
+	rp, err := p.readPref()
+	if err != nil {
+		return nil, err
+	}
+	if rp == nil {
+		return options.Database(), nil
+	}
+	return options.Database().SetReadPreference(rp), nil
+}
+
+// tagSets converts tag set maps to driver tag sets with tags sorted by name.
+func tagSets(sets []map[string]string) []tag.Set {
+	result := make([]tag.Set, 0, len(sets))
+	for _, set := range sets {
+		tags := make(tag.Set, 0, len(set))
+		for name, value := range set {
+			tags = append(tags, tag.Tag{Name: name, Value: value})
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+		result = append(result, tags)
+	}
+	return result
+}
+
+// parseTagSets parses tag sets written as name:value pairs separated by commas, with sets separated by
+// semicolons, e.g. "dc:east,rack:1;dc:west".
+func parseTagSets(s string) ([]map[string]string, error) {
+	var sets []map[string]string
+	for _, rawSet := range strings.Split(s, ";") {
+		set := make(map[string]string)
+		for _, pair := range splitList(rawSet) {
+			name, value, ok := strings.Cut(pair, ":")
+			if !ok || strings.TrimSpace(name) == "" {
+				return nil, fmt.Errorf("invalid tag %q, expected name:value", pair)
+			}
+			set[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
@@ -0,0 +1,245 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry holds the database connections set up through pmongo, keyed by database name (see DBConfig.Name).
+// It is safe for concurrent use, so databases can be registered, looked up and removed while requests are being
+// served.
+// The package level functions (Setup, SetupMongoDB, Connection, ...) operate on a default registry; tests
+// and applications that need isolated state can create their own with NewRegistry.
+type Registry struct {
+	mu          sync.RWMutex
+	dbs         map[string]Db
+	clients     map[string]*sharedClient
+	defaultName string
+	logger      Logger
+
+	// healthErrors holds the last error HealthCheck recorded per database.
+	healthErrors map[string]healthError
+	// shutdown is closed, and replaced, by Shutdown to stop the setups in progress.
+	shutdown chan struct{}
+}
+
+// defaultRegistry backs the package level connection functions.
+var defaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{dbs: make(map[string]Db), clients: make(map[string]*sharedClient), logger: defaultLogger,
+		shutdown: make(chan struct{})}
+}
+
+// SetLogger sets the logger used by the registry and the connections it returns. A nil logger discards
+// everything.
+func (r *Registry) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = NopLogger()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logger = logger
+}
+
+// Logger returns the logger used by the registry.
+func (r *Registry) Logger() Logger {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.logger
+}
+
+// DefaultRegistry returns the registry used by the package level functions.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register adds the given database to the registry, replacing any database registered under the same name. The
+// client of a replaced database set up by the registry is closed in the background once no other database
+// uses it.
+func (r *Registry) Register(db Db) {
+	r.mu.Lock()
+	replaced, ok := r.dbs[db.Config.Name()]
+	r.dbs[db.Config.Name()] = db
+	last := ok && replaced.shared != nil && r.releaseLocked(replaced)
+	r.mu.Unlock()
+
+	if last && replaced.Client != db.Client {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), replaced.Config.connectTimeout())
+			defer cancel()
+			if err := replaced.close(ctx); err != nil {
+				r.Logger().Warn("Error closing replaced client", "db", replaced.Config.Name(), "error", err)
+			}
+		}()
+	}
+}
+
+// Get returns the database registered under the given name.
+func (r *Registry) Get(dbName string) (Db, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	db, ok := r.dbs[dbName]
+	return db, ok
+}
+
+// Remove removes the database registered under the given name from the registry and returns it. The client is
+// not disconnected, even when no other database uses it anymore; use Close for that.
+func (r *Registry) Remove(dbName string) (Db, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	db, ok := r.dbs[dbName]
+	if ok {
+		delete(r.dbs, dbName)
+		delete(r.healthErrors, dbName)
+		r.releaseLocked(db)
+	}
+	return db, ok
+}
+
+// Names returns the sorted names of all registered databases.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.dbs))
+	for name := range r.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Len returns the number of registered databases.
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.dbs)
+}
+
+// SetDefault makes the given database the one returned by Connection and SecondaryConnection, so they keep
+// working when several databases are registered. The database does not need to be registered yet.
+func (r *Registry) SetDefault(dbName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultName = dbName
+}
+
+// defaultDB returns the default database, or the only registered database when no default is set.
+func (r *Registry) defaultDB() (Db, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.defaultName != "" {
+		db, ok := r.dbs[r.defaultName]
+		if !ok {
+			return Db{}, &UnknownDatabaseError{Name: r.defaultName}
+		}
+		return db, nil
+	}
+	if len(r.dbs) != 1 {
+		return Db{}, fmt.Errorf("%w: %d databases registered, use SetDefault to pick one", ErrNoDefaultDatabase, len(r.dbs))
+	}
+	for _, db := range r.dbs {
+		return db, nil
+	}
+	return Db{}, ErrNoDefaultDatabase
+}
+
+// SetupMongoDB sets up and registers a connection for each of the given configs. Every config is attempted; when
+// some fail, a *SetupError lists them while the others stay registered.
+func (r *Registry) SetupMongoDB(configs ...DBConfig) error {
+	errs := make(map[string]error)
+	for _, config := range configs {
+		if err := r.Setup(config); err != nil {
+			r.Logger().Error("Error setting up data layer", "db", config.Name(), "error", err)
+			errs[config.Name()] = err
+		}
+	}
+	if len(errs) > 0 {
+		return &SetupError{Errors: errs}
+	}
+	return nil
+}
+
+// Lookup returns the connection for the given database name, or an *UnknownDatabaseError matching
+// ErrUnknownDatabase when it is not registered.
+func (r *Registry) Lookup(dbName string) (*DBConnection, error) {
+	db, ok := r.Get(dbName)
+	if !ok {
+		return nil, &UnknownDatabaseError{Name: dbName}
+	}
+	return r.connection(db, db.Config.ReadPref())
+}
+
+// MustLookup is like Lookup but panics when the database is not registered. It is meant for initialization code.
+func (r *Registry) MustLookup(dbName string) *DBConnection {
+	conn, err := r.Lookup(dbName)
+	if err != nil {
+		panic(err)
+	}
+	return conn
+}
+
+// LookupDefault returns the connection for the default database, see SetDefault. Without a default, the only
+// registered database is used and ErrNoDefaultDatabase is returned when there are several.
+func (r *Registry) LookupDefault() (*DBConnection, error) {
+	db, err := r.defaultDB()
+	if err != nil {
+		return nil, err
+	}
+	return r.connection(db, db.Config.ReadPref())
+}
+
+// ConnectionByName returns the connection for the given database name, nil when it is not registered.
+func (r *Registry) ConnectionByName(dbName string) *DBConnection {
+	conn, _ := r.Lookup(dbName)
+	return conn
+}
+
+// Connection returns the connection for the default database, nil when there is none.
+func (r *Registry) Connection() *DBConnection {
+	conn, _ := r.LookupDefault()
+	return conn
+}
+
+// SecondaryConnectionByName returns a secondary preferred connection for the given database name, nil when it is
+// not registered.
+func (r *Registry) SecondaryConnectionByName(dbName string) *DBConnection {
+	conn, _ := r.ConnectionWith(dbName, ReadPref{Mode: SecondaryPreferredMode})
+	return conn
+}
+
+// SecondaryConnection returns a secondary preferred connection for the default database, nil when there is none.
+func (r *Registry) SecondaryConnection() *DBConnection {
+	db, err := r.defaultDB()
+	if err != nil {
+		return nil
+	}
+	conn, _ := r.connection(db, ReadPref{Mode: SecondaryPreferredMode})
+	return conn
+}
+
+// ConnectionWith returns a connection for the given database name that reads with the given read preference
+// instead of the one configured for the database.
+func (r *Registry) ConnectionWith(dbName string, pref ReadPref) (*DBConnection, error) {
+	db, ok := r.Get(dbName)
+	if !ok {
+		return nil, &UnknownDatabaseError{Name: dbName}
+	}
+	return r.connection(db, pref)
+}
+
+// connection returns a connection to the database reading with the given read preference. Databases set up in
+// lazy mode are connected on first use.
+func (r *Registry) connection(db Db, pref ReadPref) (*DBConnection, error) {
+	dbOptions, err := pref.databaseOptions()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.ensureConnected(); err != nil {
+		return nil, err
+	}
+	return &DBConnection{DB: db.Client.Database(db.Config.DBName, dbOptions), logger: r.Logger()}, nil
+}
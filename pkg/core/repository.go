@@ -0,0 +1,177 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository gives typed access to the collection of the documents of type T, e.g. Repository[*Order]: results
+// are returned as T and []T instead of interface{}. T can be a struct or a pointer to a struct; new documents
+// are allocated as needed to decode results into.
+type Repository[T Document] struct {
+	conn *DBConnection
+}
+
+// NewRepository creates a repository for the documents of type T on the given connection.
+func NewRepository[T Document](conn *DBConnection) *Repository[T] {
+	return &Repository[T]{conn: conn}
+}
+
+// Connection returns the connection the repository runs on.
+func (r *Repository[T]) Connection() *DBConnection {
+	return r.conn
+}
+
+// CollectionName returns the name of the collection holding the documents of type T.
+func (r *Repository[T]) CollectionName() string {
+	return newDocument[T]().CollectionName()
+}
+
+// Collection returns the collection holding the documents of type T.
+func (r *Repository[T]) Collection() *mongo.Collection {
+	return r.conn.Collection(r.CollectionName())
+}
+
+// Find returns the first document matching the query, or mongo.ErrNoDocuments.
+func (r *Repository[T]) Find(ctx context.Context, query Q) (T, error) {
+	return r.FindWithOpts(ctx, query, nil)
+}
+
+// FindWithOpts returns the first document matching the query with the given find options.
+func (r *Repository[T]) FindWithOpts(ctx context.Context, query Q, opts *options.FindOneOptions) (T, error) {
+	ctx = r.conn.context(ctx)
+	document := newDocument[T]()
+	err := r.Collection().FindOne(ctx, query, opts).Decode(decodeTarget(&document))
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			r.conn.log().Error("Error fetching document", "collection", r.CollectionName(), "query", query, "error", err)
+		}
+		var zero T
+		return zero, err
+	}
+	return document, nil
+}
+
+// FindByID returns the document with the given hexadecimal id.
+func (r *Repository[T]) FindByID(ctx context.Context, id string) (T, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		var zero T
+		return zero, errors.New("invalid id")
+	}
+	return r.Find(ctx, Q{"_id": objID})
+}
+
+// FindAll returns all the documents matching the query.
+func (r *Repository[T]) FindAll(ctx context.Context, query Q) ([]T, error) {
+	return r.FindAllWithOpts(ctx, query, nil)
+}
+
+// FindAllWithOpts returns all the documents matching the query with the given find options.
+func (r *Repository[T]) FindAllWithOpts(ctx context.Context, query Q, opts *options.FindOptions) ([]T, error) {
+	ctx = r.conn.context(ctx)
+	curr, err := r.Collection().Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	documents := make([]T, 0)
+	if err := curr.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// FindAllWithProjection returns all the documents matching the query with only the fields of the projection.
+func (r *Repository[T]) FindAllWithProjection(ctx context.Context, query Q, p Q) ([]T, error) {
+	return r.FindAllWithOpts(ctx, query, options.Find().SetProjection(p))
+}
+
+// FindByObjectIDs returns the documents with the given hexadecimal ids.
+func (r *Repository[T]) FindByObjectIDs(ctx context.Context, oIDs []string) ([]T, error) {
+	return r.FindAll(ctx, Q{"_id": Q{"$in": StringIDsToObjectIDs(oIDs)}})
+}
+
+// Exists checks if a document matches the query, fetching only its _id.
+func (r *Repository[T]) Exists(ctx context.Context, query Q) (bool, error) {
+	return r.conn.Exists(ctx, query, newDocument[T]())
+}
+
+// Count returns the number of documents matching the query.
+func (r *Repository[T]) Count(ctx context.Context, query Q) (int64, error) {
+	return r.conn.Count(ctx, query, newDocument[T]())
+}
+
+// CountWithOpts returns the number of documents matching the query with the given count options.
+func (r *Repository[T]) CountWithOpts(ctx context.Context, query Q, opts *options.CountOptions) (int64, error) {
+	return r.conn.CountWithOpts(ctx, query, newDocument[T](), opts)
+}
+
+// EstimatedCount returns the number of documents in the collection from its metadata.
+func (r *Repository[T]) EstimatedCount(ctx context.Context) (int64, error) {
+	return r.conn.EstimatedCount(ctx, newDocument[T]())
+}
+
+// Save inserts the document.
+func (r *Repository[T]) Save(ctx context.Context, document T) error {
+	return r.conn.Save(ctx, document)
+}
+
+// Update replaces the document matching the selector.
+func (r *Repository[T]) Update(ctx context.Context, selector Q, document T) error {
+	return r.conn.Update(ctx, selector, document)
+}
+
+// UpdateByID replaces the document with the given hexadecimal id.
+func (r *Repository[T]) UpdateByID(ctx context.Context, id string, document T) error {
+	return r.conn.UpdateByID(ctx, id, document)
+}
+
+// Upsert replaces the document matching the selector, inserting it when there is none.
+func (r *Repository[T]) Upsert(ctx context.Context, selector Q, document T) error {
+	return r.conn.Upsert(ctx, selector, document)
+}
+
+// Remove removes the first document matching the query.
+func (r *Repository[T]) Remove(ctx context.Context, query Q) error {
+	return r.conn.Remove(ctx, query, newDocument[T]())
+}
+
+// RemoveByID removes the document with the given hexadecimal id.
+func (r *Repository[T]) RemoveByID(ctx context.Context, id string) error {
+	return r.conn.RemoveByID(ctx, id, newDocument[T]())
+}
+
+// RemoveAll removes all the documents matching the query and returns how many were removed.
+func (r *Repository[T]) RemoveAll(ctx context.Context, query Q) (int64, error) {
+	return r.conn.RemoveAllWithCount(ctx, query, newDocument[T]())
+}
+
+// newDocument returns a new T to decode into: a pointer to a new zero value when T is a pointer type, the zero
+// value otherwise.
+func newDocument[T any]() T {
+	var document T
+	if t := reflect.TypeOf(document); t != nil && t.Kind() == reflect.Pointer {
+		document = reflect.New(t.Elem()).Interface().(T)
+	}
+	return document
+}
+
+// decodeTarget returns what to pass to Decode to fill the given document: the document itself when it is a
+// pointer, its address otherwise.
+func decodeTarget[T any](document *T) interface{} {
+	if reflect.ValueOf(*document).Kind() == reflect.Pointer {
+		return *document
+	}
+	return document
+}
+
+// documentTarget returns decodeTarget as a Document, which it always is: either T itself or a pointer to T,
+// whose method set includes the CollectionName method of T.
+func documentTarget[T Document](document *T) Document {
+	return decodeTarget(document).(Document)
+}
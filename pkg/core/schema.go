@@ -0,0 +1,334 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SchemaOptions are the options of ApplySchema. ValidationLevel is "strict", the default, or "moderate" to only
+// validate inserts and updates of valid documents. ValidationAction is "error", the default, or "warn" to only
+// log invalid writes. With DryRun the differences are reported but the schema is not applied.
+type SchemaOptions struct {
+	ValidationLevel  string
+	ValidationAction string
+	DryRun           bool
+}
+
+// SchemaDiff compares the validator of a collection with the schema of its documents. Changes lists the
+// differences as "+ path: value", "- path: value" or "~ path: current -> desired", sorted by path; it is empty
+// when the collection is up to date. Applied reports whether the schema was applied.
+type SchemaDiff struct {
+	Collection string
+	Exists     bool
+	Current    Q
+	Desired    Q
+	Changes    []string
+	Applied    bool
+}
+
+// Types whose bson representation is not derived from their fields.
+var (
+	timeType           = reflect.TypeOf(time.Time{})
+	objectIDType       = reflect.TypeOf(primitive.ObjectID{})
+	dateTimeType       = reflect.TypeOf(primitive.DateTime(0))
+	decimalType        = reflect.TypeOf(primitive.Decimal128{})
+	timestampType      = reflect.TypeOf(primitive.Timestamp{})
+	binaryType         = reflect.TypeOf(primitive.Binary{})
+	regexType          = reflect.TypeOf(primitive.Regex{})
+	rawType            = reflect.TypeOf(bson.Raw{})
+	dType              = reflect.TypeOf(bson.D{})
+	marshalerType      = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+	valueMarshalerType = reflect.TypeOf((*bsoncodec.ValueMarshaler)(nil)).Elem()
+)
+
+// JSONSchema derives the $jsonSchema validating the documents of the same type as document, from the bson tags
+// of its struct:
+//   - fields are named after their bson tag, or their lower cased name without one, and inline structs such
+//     as BaseData contribute their fields;
+//   - only fields tagged binding:"required" are required, so documents written before a field was added
+//     still validate;
+//   - pointers are optional and may be null, as may slices and maps, which the driver writes as null when nil;
+//   - nested structs, slices and maps are validated recursively, interface{} fields and types with their own
+//     bson marshaling are not constrained.
+//
+// Properties that are not declared are allowed, so documents may carry fields the struct does not know about.
+func JSONSchema(document Document) Q {
+	t := reflect.TypeOf(document)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return schemaOf(t, map[reflect.Type]bool{})
+}
+
+// schemaOf returns the schema of the values of type t. visiting guards against recursive types.
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) Q {
+	switch t {
+	case timeType, dateTimeType:
+		return Q{"bsonType": "date"}
+	case objectIDType:
+		return Q{"bsonType": "objectId"}
+	case decimalType:
+		return Q{"bsonType": "decimal"}
+	case timestampType:
+		return Q{"bsonType": "timestamp"}
+	case binaryType:
+		return Q{"bsonType": "binData"}
+	case regexType:
+		return Q{"bsonType": "regex"}
+	case rawType, dType:
+		return Q{"bsonType": "object"}
+	}
+	if t.Implements(marshalerType) || t.Implements(valueMarshalerType) ||
+		reflect.PointerTo(t).Implements(marshalerType) || reflect.PointerTo(t).Implements(valueMarshalerType) {
+		return Q{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(schemaOf(t.Elem(), visiting))
+	case reflect.Bool:
+		return Q{"bsonType": "bool"}
+	case reflect.String:
+		return Q{"bsonType": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// The driver writes integers as int when they fit, long otherwise.
+		return Q{"bsonType": []string{"int", "long"}}
+	case reflect.Float32, reflect.Float64:
+		return Q{"bsonType": "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nullable(Q{"bsonType": "binData"})
+		}
+		return nullable(Q{"bsonType": "array", "items": schemaOf(t.Elem(), visiting)})
+	case reflect.Array:
+		return Q{"bsonType": "array", "items": schemaOf(t.Elem(), visiting)}
+	case reflect.Map:
+		schema := Q{"bsonType": "object"}
+		if values := schemaOf(t.Elem(), visiting); len(values) > 0 {
+			schema["additionalProperties"] = values
+		}
+		return nullable(schema)
+	case reflect.Struct:
+		if visiting[t] {
+			return Q{"bsonType": "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		properties := Q{}
+		var required []string
+		structSchema(t, visiting, properties, &required)
+		schema := Q{"bsonType": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return Q{}
+}
+
+// structSchema adds the properties of the fields of the struct, and those that are required, following inline
+// structs.
+func structSchema(t reflect.Type, visiting map[reflect.Type]bool, properties Q, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag, tagged := field.Tag.Lookup("bson")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		inline := slices.Contains(strings.Split(options, ","), "inline")
+		if !tagged || name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		if inline {
+			inlined := field.Type
+			for inlined.Kind() == reflect.Pointer {
+				inlined = inlined.Elem()
+			}
+			// Inline maps hold arbitrary fields, which are allowed anyway.
+			if inlined.Kind() == reflect.Struct {
+				structSchema(inlined, visiting, properties, required)
+			}
+			continue
+		}
+
+		properties[name] = schemaOf(field.Type, visiting)
+		if strings.Contains(","+field.Tag.Get("binding")+",", ",required,") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// nullable allows null besides the types of the schema.
+func nullable(schema Q) Q {
+	switch bsonType := schema["bsonType"].(type) {
+	case string:
+		schema["bsonType"] = []string{bsonType, "null"}
+	case []string:
+		if !slices.Contains(bsonType, "null") {
+			schema["bsonType"] = append(append([]string(nil), bsonType...), "null")
+		}
+	}
+	return schema
+}
+
+// collectionInfo is the part of the listCollections output describing the validator of a collection.
+type collectionInfo struct {
+	Options struct {
+		Validator        bson.M `bson:"validator"`
+		ValidationLevel  string `bson:"validationLevel"`
+		ValidationAction string `bson:"validationAction"`
+	} `bson:"options"`
+}
+
+// ApplySchema sets the JSONSchema of document as the validator of its collection, creating the collection when
+// it does not exist, and reports the differences with the previous validator. Nothing is written when the
+// collection is up to date or in dry-run mode.
+func (s *DBConnection) ApplySchema(ctx context.Context, document Document, opts SchemaOptions) (SchemaDiff, error) {
+	collectionName := document.CollectionName()
+	level, action := opts.ValidationLevel, opts.ValidationAction
+	if level == "" {
+		level = "strict"
+	}
+	if action == "" {
+		action = "error"
+	}
+	desired, err := normalizeSchema(JSONSchema(document))
+	if err != nil {
+		return SchemaDiff{}, err
+	}
+	diff := SchemaDiff{Collection: collectionName, Desired: desired}
+
+	cursor, err := s.DB.ListCollections(ctx, Q{"name": collectionName})
+	if err != nil {
+		return diff, err
+	}
+	var infos []collectionInfo
+	if err := cursor.All(ctx, &infos); err != nil {
+		return diff, err
+	}
+	current := Q{}
+	currentLevel, currentAction := "strict", "error"
+	if len(infos) > 0 {
+		diff.Exists = true
+		if schema, ok := infos[0].Options.Validator["$jsonSchema"].(bson.M); ok {
+			current = Q(schema)
+			diff.Current = current
+		}
+		if infos[0].Options.ValidationLevel != "" {
+			currentLevel = infos[0].Options.ValidationLevel
+		}
+		if infos[0].Options.ValidationAction != "" {
+			currentAction = infos[0].Options.ValidationAction
+		}
+	}
+
+	diff.Changes = schemaChanges(current, desired)
+	if currentLevel != level {
+		diff.Changes = append(diff.Changes, fmt.Sprintf("~ validationLevel: %s -> %s", currentLevel, level))
+	}
+	if currentAction != action {
+		diff.Changes = append(diff.Changes, fmt.Sprintf("~ validationAction: %s -> %s", currentAction, action))
+	}
+	if opts.DryRun || (diff.Exists && len(diff.Changes) == 0) {
+		return diff, nil
+	}
+
+	validator := Q{"$jsonSchema": desired}
+	if !diff.Exists {
+		createOpts := options.CreateCollection().SetValidator(validator).SetValidationLevel(level).SetValidationAction(action)
+		if err := s.DB.CreateCollection(ctx, collectionName, createOpts); err != nil {
+			return diff, err
+		}
+	} else {
+		command := bson.D{
+			{Key: "collMod", Value: collectionName},
+			{Key: "validator", Value: validator},
+			{Key: "validationLevel", Value: level},
+			{Key: "validationAction", Value: action},
+		}
+		if err := s.DB.RunCommand(ctx, command).Err(); err != nil {
+			return diff, err
+		}
+	}
+	diff.Applied = true
+	s.log().Info("Applied schema", "collection", collectionName, "changes", len(diff.Changes))
+	return diff, nil
+}
+
+// normalizeSchema round trips the schema through bson, so that its values have the types of the schemas read
+// back from the server.
+func normalizeSchema(schema Q) (Q, error) {
+	data, err := bson.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var normalized bson.M
+	if err := bson.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return Q(normalized), nil
+}
+
+// schemaChanges lists the differences between the current and desired schemas, see SchemaDiff.
+func schemaChanges(current, desired Q) []string {
+	currentValues, desiredValues := map[string]string{}, map[string]string{}
+	flattenSchema("", current, currentValues)
+	flattenSchema("", desired, desiredValues)
+
+	var changes []string
+	for path, value := range desiredValues {
+		previous, ok := currentValues[path]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("+ %s: %s", path, value))
+		case previous != value:
+			changes = append(changes, fmt.Sprintf("~ %s: %s -> %s", path, previous, value))
+		}
+	}
+	for path, value := range currentValues {
+		if _, ok := desiredValues[path]; !ok {
+			changes = append(changes, fmt.Sprintf("- %s: %s", path, value))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i][2:] < changes[j][2:] })
+	return changes
+}
+
+// flattenSchema flattens the nested documents of the schema into values by dotted path. Arrays and empty
+// documents, such as the schemas of unconstrained fields, are values.
+func flattenSchema(prefix string, schema map[string]interface{}, values map[string]string) {
+	if len(schema) == 0 && prefix != "" {
+		values[prefix] = "{}"
+		return
+	}
+	for key, value := range schema {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case bson.M:
+			flattenSchema(path, v, values)
+		case Q:
+			flattenSchema(path, v, values)
+		default:
+			values[path] = fmt.Sprint(v)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// drainInterval is how often Close checks whether the in-flight commands of a client have finished.
+const drainInterval = 10 * time.Millisecond
+
+// opTracker counts the commands in flight on a client so they can be drained before it is disconnected.
+type opTracker struct {
+	inflight int64
+}
+
+// monitor returns the command monitor that keeps the in-flight count up to date.
+func (t *opTracker) monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(context.Context, *event.CommandStartedEvent) {
+			atomic.AddInt64(&t.inflight, 1)
+		},
+		Succeeded: func(context.Context, *event.CommandSucceededEvent) {
+			atomic.AddInt64(&t.inflight, -1)
+		},
+		Failed: func(context.Context, *event.CommandFailedEvent) {
+			atomic.AddInt64(&t.inflight, -1)
+		},
+	}
+}
+
+// inFlight returns the number of commands currently running on the client.
+func (t *opTracker) inFlight() int64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&t.inflight)
+}
+
+// drain blocks until there are no commands in flight or the context is done.
+func (t *opTracker) drain(ctx context.Context) error {
+	if t.inFlight() == 0 {
+		return nil
+	}
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d operation(s) still in flight: %w", t.inFlight(), ctx.Err())
+		case <-ticker.C:
+			if t.inFlight() == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// InFlight returns the number of commands currently running against the database's client.
+func (db Db) InFlight() int64 {
+	return db.ops.inFlight()
+}
+
+// close waits for the in-flight commands of the database's client to finish and disconnects it.
+func (db Db) close(ctx context.Context) error {
+	if db.Client == nil || (db.shared != nil && !db.shared.isConnected()) {
+		return nil
+	}
+	drainErr := db.ops.drain(ctx)
+	if err := db.Client.Disconnect(ctx); err != nil {
+		return err
+	}
+	return drainErr
+}
+
+// Close removes the database from the registry and, unless other databases share its client, waits for the
+// client's in-flight operations to finish and disconnects it. New lookups fail as soon as Close is called; the
+// context bounds how long it waits.
+func (r *Registry) Close(ctx context.Context, dbName string) error {
+	r.mu.Lock()
+	db, ok := r.dbs[dbName]
+	if !ok {
+		r.mu.Unlock()
+		return &UnknownDatabaseError{Name: dbName}
+	}
+	delete(r.dbs, dbName)
+	delete(r.healthErrors, dbName)
+	last := r.releaseLocked(db)
+	r.mu.Unlock()
+
+	if !last {
+		return nil
+	}
+	return db.close(ctx)
+}
+
+// Shutdown closes every registered database. Each client is drained and disconnected once, concurrently, and a
+// *ShutdownError lists the databases whose client failed to close.
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	dbs := r.dbs
+	r.dbs = make(map[string]Db)
+	r.clients = make(map[string]*sharedClient)
+	r.healthErrors = nil
+	close(r.shutdown)
+	r.shutdown = make(chan struct{})
+	r.mu.Unlock()
+
+	clients := make(map[*mongo.Client]Db)
+	names := make(map[*mongo.Client][]string)
+	for name, db := range dbs {
+		clients[db.Client] = db
+		names[db.Client] = append(names[db.Client], name)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = make(map[string]error)
+	)
+	for client, db := range clients {
+		wg.Add(1)
+		go func(client *mongo.Client, db Db) {
+			defer wg.Done()
+			if err := db.close(ctx); err != nil {
+				mu.Lock()
+				for _, name := range names[client] {
+					errs[name] = err
+				}
+				mu.Unlock()
+			}
+		}(client, db)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &ShutdownError{Errors: errs}
+	}
+	return nil
+}
+
+// Close closes the database registered under the given name in the default registry.
+func Close(ctx context.Context, dbName string) error {
+	return defaultRegistry.Close(ctx, dbName)
+}
+
+// Shutdown closes every database registered in the default registry.
+func Shutdown(ctx context.Context) error {
+	return defaultRegistry.Shutdown(ctx)
+}
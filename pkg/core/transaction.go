@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// TxOptions are the options of a transaction. ReadConcern is "local", "majority" or "snapshot", Majority
+// acknowledges the commit once it is written to a majority of the replica set and MaxCommitTime bounds the
+// commit on the server. Zero values leave the client defaults.
+type TxOptions struct {
+	ReadConcern   string
+	Majority      bool
+	MaxCommitTime time.Duration
+}
+
+// transactionOptions returns the driver options for the transaction options.
+func (o TxOptions) transactionOptions() *options.TransactionOptions {
+	opts := options.Transaction()
+	if o.ReadConcern != "" {
+		opts.SetReadConcern(readconcern.New(readconcern.Level(o.ReadConcern)))
+	}
+	if o.Majority {
+		opts.SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
+	}
+	if o.MaxCommitTime > 0 {
+		opts.SetMaxCommitTime(&o.MaxCommitTime)
+	}
+	return opts
+}
+
+// WithTransaction runs fn in a multi-document transaction, committed when fn returns nil and aborted otherwise.
+// Every method of the tx connection given to fn, and of the repositories created on it, runs inside the
+// transaction whatever the context passed to them:
+//
+//	err := conn.WithTransaction(ctx, func(tx *core.DBConnection) error {
+//		if err := tx.Save(ctx, order); err != nil {
+//			return err
+//		}
+//		return tx.Save(ctx, history)
+//	})
+//
+// The whole transaction is retried when it fails with a TransientTransactionError, such as a write conflict,
+// and the commit when its outcome is unknown (UnknownTransactionCommitResult), until the context is done or
+// for up to two minutes. fn may thus run several times and should have no side effects outside of the
+// database. Transactions require a replica set or a sharded cluster. Called on a tx connection, WithTransaction
+// runs fn in the ongoing transaction.
+func (s *DBConnection) WithTransaction(ctx context.Context, fn func(tx *DBConnection) error, opts ...TxOptions) error {
+	if s.session != nil {
+		return fn(s)
+	}
+
+	var txOptions TxOptions
+	if len(opts) > 0 {
+		txOptions = opts[0]
+	}
+	session, err := s.DB.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	tx := &DBConnection{DB: s.DB, logger: s.logger, session: session}
+	_, err = session.WithTransaction(ctx, func(mongo.SessionContext) (interface{}, error) {
+		return nil, fn(tx)
+	}, txOptions.transactionOptions())
+	return err
+}
+
+// context returns ctx bound to the session of the connection, so that the driver runs the operation in its
+// transaction. Contexts already carrying a session and connections without one are left as is.
+func (s *DBConnection) context(ctx context.Context) context.Context {
+	if s.session == nil || mongo.SessionFromContext(ctx) != nil {
+		return ctx
+	}
+	return mongo.NewSessionContext(ctx, s.session)
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Update builds a partial update of documents, to run with UpdateOne or UpdateMany:
+//
+//	update := core.NewUpdate().
+//		Set("status", "shipped").
+//		Inc("attempts", 1).
+//		Set(core.FilteredPositional("items", "item")+".shipped", true).
+//		ArrayFilter(core.Where("item.sku").In(skus...))
+//	result, err := conn.UpdateMany(ctx, core.Where("orderId").Eq(id), update, &Order{})
+//
+// Calls are chained; setting the same field twice with the same operator keeps the last value.
+type Update = UpdateOf[string]
+
+// UpdateOf builds a partial update taking field paths of type F, such as the field type pmongo-gen generates
+// for a document, so that its constants need no conversion:
+//
+//	update := core.NewUpdateOf[OrderField]().
+//		Set(OrderStatus, "shipped").
+//		Set(core.FilteredPositional(OrderItems, "item")+".shipped", true)
+type UpdateOf[F ~string] struct {
+	operators    map[string]Q
+	arrayFilters []interface{}
+	upsert       bool
+}
+
+// Updater is an update built with NewUpdate or NewUpdateOf, whatever the type of its field paths.
+type Updater interface {
+	Q() Q
+	untyped() *Update
+}
+
+// UpdateResult holds the outcome of UpdateOne and UpdateMany. UpsertedID is the _id of the inserted document
+// when the update upserted one.
+type UpdateResult struct {
+	Matched    int64
+	Modified   int64
+	Upserted   int64
+	UpsertedID interface{}
+}
+
+// NewUpdate creates an empty update taking field paths as strings.
+func NewUpdate() *Update {
+	return NewUpdateOf[string]()
+}
+
+// NewUpdateOf creates an empty update taking field paths of type F.
+func NewUpdateOf[F ~string]() *UpdateOf[F] {
+	return &UpdateOf[F]{operators: make(map[string]Q)}
+}
+
+// Positional returns the path updating the first array element matched by the query, e.g. "items.$".
+func Positional[F ~string](field F) F {
+	return field + ".$"
+}
+
+// AllPositional returns the path updating every element of the array, e.g. "items.$[]".
+func AllPositional[F ~string](field F) F {
+	return field + ".$[]"
+}
+
+// FilteredPositional returns the path updating the array elements matching the array filter on identifier,
+// e.g. "items.$[item]", see ArrayFilter.
+func FilteredPositional[F ~string](field F, identifier string) F {
+	return field + F(".$["+identifier+"]")
+}
+
+// set adds the field with its value to the operator.
+func (u *UpdateOf[F]) set(operator string, field F, value interface{}) *UpdateOf[F] {
+	fields, ok := u.operators[operator]
+	if !ok {
+		fields = Q{}
+		u.operators[operator] = fields
+	}
+	fields[string(field)] = value
+	return u
+}
+
+// Set sets the field to value.
+func (u *UpdateOf[F]) Set(field F, value interface{}) *UpdateOf[F] {
+	return u.set("$set", field, value)
+}
+
+// SetOnInsert sets the field to value only when the update inserts the document, see Upsert.
+func (u *UpdateOf[F]) SetOnInsert(field F, value interface{}) *UpdateOf[F] {
+	return u.set("$setOnInsert", field, value)
+}
+
+// Unset removes the fields.
+func (u *UpdateOf[F]) Unset(fields ...F) *UpdateOf[F] {
+	for _, field := range fields {
+		u.set("$unset", field, "")
+	}
+	return u
+}
+
+// Inc increments the field by n, which can be negative.
+func (u *UpdateOf[F]) Inc(field F, n interface{}) *UpdateOf[F] {
+	return u.set("$inc", field, n)
+}
+
+// Mul multiplies the field by n.
+func (u *UpdateOf[F]) Mul(field F, n interface{}) *UpdateOf[F] {
+	return u.set("$mul", field, n)
+}
+
+// Min sets the field to value when value is less than its current value.
+func (u *UpdateOf[F]) Min(field F, value interface{}) *UpdateOf[F] {
+	return u.set("$min", field, value)
+}
+
+// Max sets the field to value when value is greater than its current value.
+func (u *UpdateOf[F]) Max(field F, value interface{}) *UpdateOf[F] {
+	return u.set("$max", field, value)
+}
+
+// Rename renames the field to newName.
+func (u *UpdateOf[F]) Rename(field, newName F) *UpdateOf[F] {
+	return u.set("$rename", field, string(newName))
+}
+
+// CurrentDate sets the field to the current date on the server.
+func (u *UpdateOf[F]) CurrentDate(field F) *UpdateOf[F] {
+	return u.set("$currentDate", field, true)
+}
+
+// Push appends value to the array field.
+func (u *UpdateOf[F]) Push(field F, value interface{}) *UpdateOf[F] {
+	return u.set("$push", field, value)
+}
+
+// PushEach appends the values to the array field.
+func (u *UpdateOf[F]) PushEach(field F, values ...interface{}) *UpdateOf[F] {
+	return u.set("$push", field, Q{"$each": values})
+}
+
+// AddToSet appends value to the array field unless it already holds it.
+func (u *UpdateOf[F]) AddToSet(field F, value interface{}) *UpdateOf[F] {
+	return u.set("$addToSet", field, value)
+}
+
+// AddToSetEach appends the values the array field does not already hold.
+func (u *UpdateOf[F]) AddToSetEach(field F, values ...interface{}) *UpdateOf[F] {
+	return u.set("$addToSet", field, Q{"$each": values})
+}
+
+// Pull removes from the array field the elements equal to value, or matching it when it is a condition such as
+// Where("").Gt(5) or Where("sku").Eq("x").
+func (u *UpdateOf[F]) Pull(field F, value interface{}) *UpdateOf[F] {
+	if condition, ok := value.(Q); ok {
+		if expression, ok := condition[""]; ok && len(condition) == 1 {
+			value = expression
+		}
+	}
+	return u.set("$pull", field, value)
+}
+
+// PullAll removes from the array field the elements equal to any of the values.
+func (u *UpdateOf[F]) PullAll(field F, values ...interface{}) *UpdateOf[F] {
+	return u.set("$pullAll", field, values)
+}
+
+// PopFirst removes the first element of the array field.
+func (u *UpdateOf[F]) PopFirst(field F) *UpdateOf[F] {
+	return u.set("$pop", field, -1)
+}
+
+// PopLast removes the last element of the array field.
+func (u *UpdateOf[F]) PopLast(field F) *UpdateOf[F] {
+	return u.set("$pop", field, 1)
+}
+
+// ArrayFilter adds a filter selecting the array elements updated through FilteredPositional paths. Its field
+// paths start with the identifier, e.g. Where("item.qty").Gt(0).
+func (u *UpdateOf[F]) ArrayFilter(filter Q) *UpdateOf[F] {
+	u.arrayFilters = append(u.arrayFilters, filter)
+	return u
+}
+
+// Upsert makes the update insert a document when none matches the selector.
+func (u *UpdateOf[F]) Upsert(upsert bool) *UpdateOf[F] {
+	u.upsert = upsert
+	return u
+}
+
+// Q renders the update document.
+func (u *UpdateOf[F]) Q() Q {
+	q := make(Q, len(u.operators))
+	for operator, fields := range u.operators {
+		q[operator] = fields
+	}
+	return q
+}
+
+// options returns the update options for the array filters and upsert flag.
+func (u *UpdateOf[F]) options() *options.UpdateOptions {
+	opts := options.Update()
+	if len(u.arrayFilters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: u.arrayFilters})
+	}
+	if u.upsert {
+		opts.SetUpsert(true)
+	}
+	return opts
+}
+
+// untyped returns the update as one taking string paths, which it is once built.
+func (u *UpdateOf[F]) untyped() *Update {
+	return (*Update)(u)
+}
+
+// nonEmpty returns the update behind the updater, or ErrEmptyUpdate when it is nil or has no operator.
+func nonEmpty(updater Updater) (*Update, error) {
+	if updater == nil {
+		return nil, ErrEmptyUpdate
+	}
+	update := updater.untyped()
+	if update == nil || len(update.operators) == 0 {
+		return nil, ErrEmptyUpdate
+	}
+	return update, nil
+}
+
+// UpdateOne applies the update to the first document matching the selector.
+func (s *DBConnection) UpdateOne(ctx context.Context, selector Q, updater Updater, document Document) (UpdateResult, error) {
+	ctx = s.context(ctx)
+	update, err := nonEmpty(updater)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	res, err := s.Collection(document.CollectionName()).UpdateOne(ctx, selector, update.Q(), update.options())
+	return updateResult(res), err
+}
+
+// UpdateMany applies the update to every document matching the selector.
+func (s *DBConnection) UpdateMany(ctx context.Context, selector Q, updater Updater, document Document) (UpdateResult, error) {
+	ctx = s.context(ctx)
+	update, err := nonEmpty(updater)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	res, err := s.Collection(document.CollectionName()).UpdateMany(ctx, selector, update.Q(), update.options())
+	return updateResult(res), err
+}
+
+// UpdateOne applies the update to the first document matching the selector.
+func (r *Repository[T]) UpdateOne(ctx context.Context, selector Q, update Updater) (UpdateResult, error) {
+	return r.conn.UpdateOne(ctx, selector, update, newDocument[T]())
+}
+
+// UpdateMany applies the update to every document matching the selector.
+func (r *Repository[T]) UpdateMany(ctx context.Context, selector Q, update Updater) (UpdateResult, error) {
+	return r.conn.UpdateMany(ctx, selector, update, newDocument[T]())
+}
+
+// updateResult converts the driver result, nil when the update failed.
+func updateResult(res *mongo.UpdateResult) UpdateResult {
+	if res == nil {
+		return UpdateResult{}
+	}
+	return UpdateResult{
+		Matched:    res.MatchedCount,
+		Modified:   res.ModifiedCount,
+		Upserted:   res.UpsertedCount,
+		UpsertedID: res.UpsertedID,
+	}
+}
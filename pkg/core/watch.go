@@ -0,0 +1,307 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultResumeTokenCollection is the collection NewMongoTokenStore keeps resume tokens in by default.
+const DefaultResumeTokenCollection = "resumeTokens"
+
+// ErrNoFullDocument is returned by ChangeEvent.Decode for events without a full document, such as deletes, or
+// updates watched without WatchOptions.FullDocument.
+var ErrNoFullDocument = errors.New("change event has no full document")
+
+// OperationType is the type of operation a change event reports.
+type OperationType string
+
+// Operation types of change events.
+const (
+	OperationInsert       OperationType = "insert"
+	OperationUpdate       OperationType = "update"
+	OperationReplace      OperationType = "replace"
+	OperationDelete       OperationType = "delete"
+	OperationDrop         OperationType = "drop"
+	OperationRename       OperationType = "rename"
+	OperationDropDatabase OperationType = "dropDatabase"
+	OperationInvalidate   OperationType = "invalidate"
+)
+
+// ChangeEvent is a change to a watched collection. ID is the resume token of the event.
+type ChangeEvent struct {
+	ID                bson.Raw            `bson:"_id"`
+	OperationType     OperationType       `bson:"operationType"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+	Namespace         Namespace           `bson:"ns"`
+	DocumentKey       bson.Raw            `bson:"documentKey"`
+	FullDocument      bson.Raw            `bson:"fullDocument"`
+	UpdateDescription *UpdateDescription  `bson:"updateDescription"`
+}
+
+// Namespace is the database and collection a change event happened in.
+type Namespace struct {
+	Database   string `bson:"db"`
+	Collection string `bson:"coll"`
+}
+
+// UpdateDescription describes the fields changed by an update event.
+type UpdateDescription struct {
+	UpdatedFields bson.Raw `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// Decode decodes the full document of the event into document, see ErrNoFullDocument.
+func (e ChangeEvent) Decode(document interface{}) error {
+	if len(e.FullDocument) == 0 {
+		return ErrNoFullDocument
+	}
+	return bson.Unmarshal(e.FullDocument, document)
+}
+
+// DocumentID returns the _id of the changed document, nil for events not about a single document.
+func (e ChangeEvent) DocumentID() interface{} {
+	if len(e.DocumentKey) == 0 {
+		return nil
+	}
+	return documentID(e.DocumentKey)
+}
+
+// ResumeTokenStore persists the resume token of the last handled event of a watch, so that a restarted consumer
+// resumes right after it. Load returns nil when no token was saved under the name yet.
+type ResumeTokenStore interface {
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	Save(ctx context.Context, name string, token bson.Raw) error
+}
+
+// WatchOptions are the options of Watch.
+type WatchOptions struct {
+	// Name identifies the watch in the Store, the collection name by default. Consumers of the same collection
+	// with different pipelines or handlers need different names.
+	Name string
+	// Store persists resume tokens, nil to start from the current time on every call.
+	Store ResumeTokenStore
+	// FullDocument includes the current version of the document in update events.
+	FullDocument bool
+	// BatchSize and MaxAwaitTime tune the getMore commands of the change stream.
+	BatchSize    int32
+	MaxAwaitTime time.Duration
+	// MaxRetries bounds the consecutive resume attempts after transient errors, 0 to retry until the context is
+	// done. Attempts are spaced by an exponential backoff from RetryBackoff up to MaxRetryBackoff, defaulting
+	// to 500ms and 30s.
+	MaxRetries      int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+}
+
+// stopError wraps the errors that stop a watch instead of being retried: errors of the handler, of decoding
+// events and of the token store.
+type stopError struct {
+	err error
+}
+
+func (e *stopError) Error() string {
+	return e.err.Error()
+}
+
+// Watch watches the changes to the collection of document matching the pipeline, nil for all of them, and
+// calls handler with each event. It blocks until the context is done or the handler returns an error, returning
+// that error, or until the collection is dropped or renamed, returning nil after the invalidate event, or once
+// the server closes the stream when the pipeline filters that event out.
+//
+// Transient errors, such as a failover or a network error, are retried with backoff, resuming after the last
+// handled event, or from where the first stream was opened when none was handled yet. With a Store, the token
+// of every handled event is saved once the handler returns, so a consumer restarted after a crash handles again
+// at most the event it was handling.
+//
+//	store := core.NewMongoTokenStore(conn, "")
+//	err := conn.Watch(ctx, &Order{}, core.NewPipeline().Match(core.Where("operationType").Eq("update")),
+//		func(ctx context.Context, event core.ChangeEvent) error {
+//			order := &Order{}
+//			if err := event.Decode(order); err != nil {
+//				return err
+//			}
+//			return notify(ctx, order)
+//		}, core.WatchOptions{Store: store, FullDocument: true})
+func (s *DBConnection) Watch(ctx context.Context, document Document, pipeline *Pipeline, handler func(context.Context, ChangeEvent) error, opts WatchOptions) error {
+	collectionName := document.CollectionName()
+	name := opts.Name
+	if name == "" {
+		name = collectionName
+	}
+	base, max := opts.RetryBackoff, opts.MaxRetryBackoff
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxRetryBackoff
+	}
+
+	var token bson.Raw
+	if opts.Store != nil {
+		var err error
+		if token, err = opts.Store.Load(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		handled, err := s.watch(ctx, collectionName, pipeline, handler, opts, name, &token)
+		if err == nil {
+			return nil
+		}
+		var stopErr *stopError
+		if errors.As(err, &stopErr) {
+			return stopErr.err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if handled {
+			attempt = 0
+		}
+		if !resumable(err) || (opts.MaxRetries > 0 && attempt >= opts.MaxRetries) {
+			return err
+		}
+
+		delay := backoff(attempt, base, max)
+		s.log().Warn("Change stream interrupted, resuming", "collection", collectionName, "attempt", attempt+1,
+			"retryIn", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watch opens a change stream resuming after token and handles its events until an error occurs, updating
+// token as events are handled. It reports whether any event was handled, and returns nil once the stream is
+// invalidated or closed by the server.
+func (s *DBConnection) watch(ctx context.Context, collectionName string, pipeline *Pipeline, handler func(context.Context, ChangeEvent) error,
+	opts WatchOptions, name string, token *bson.Raw) (bool, error) {
+	streamOpts := options.ChangeStream()
+	if *token != nil {
+		streamOpts.SetResumeAfter(*token)
+	}
+	if opts.FullDocument {
+		streamOpts.SetFullDocument(options.UpdateLookup)
+	}
+	if opts.BatchSize > 0 {
+		streamOpts.SetBatchSize(opts.BatchSize)
+	}
+	if opts.MaxAwaitTime > 0 {
+		streamOpts.SetMaxAwaitTime(opts.MaxAwaitTime)
+	}
+
+	stream, err := s.Collection(collectionName).Watch(ctx, pipeline.Stages(), streamOpts)
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close(context.Background())
+
+	// Without a token yet, resume from where the stream was opened so that the events happening before a
+	// transient error are not missed.
+	if *token == nil {
+		recordResumeToken(stream, token)
+	}
+
+	handled := false
+	for {
+		if !stream.TryNext(ctx) {
+			if err := stream.Err(); err != nil {
+				return handled, err
+			}
+			// The server closed the cursor, after an invalidate event the pipeline filtered out.
+			if stream.ID() == 0 {
+				return handled, nil
+			}
+			// Empty batches move the token past the events filtered out by the pipeline.
+			recordResumeToken(stream, token)
+			continue
+		}
+		var event ChangeEvent
+		if err := stream.Decode(&event); err != nil {
+			return handled, &stopError{err: &DecodeError{ID: documentID(stream.Current), Err: err}}
+		}
+		if err := handler(ctx, event); err != nil {
+			return handled, &stopError{err: err}
+		}
+		handled = true
+		if event.OperationType == OperationInvalidate {
+			return handled, nil
+		}
+
+		recordResumeToken(stream, token)
+		if opts.Store != nil {
+			if err := opts.Store.Save(ctx, name, *token); err != nil {
+				return handled, &stopError{err: err}
+			}
+		}
+	}
+}
+
+// recordResumeToken copies the current resume token of the stream to token, keeping token when the server
+// reports none.
+func recordResumeToken(stream *mongo.ChangeStream, token *bson.Raw) {
+	if current := stream.ResumeToken(); current != nil {
+		*token = append(bson.Raw(nil), current...)
+	}
+}
+
+// resumable reports whether a change stream failing with err can be resumed.
+func resumable(err error) bool {
+	// Server selection timeouts, while no member is primary during a failover, are timeouts too.
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorLabel("ResumableChangeStreamError")
+}
+
+// MongoTokenStore is a ResumeTokenStore keeping resume tokens in a collection, one document per watch name.
+type MongoTokenStore struct {
+	conn       *DBConnection
+	collection string
+}
+
+// resumeToken is the document MongoTokenStore keeps a resume token in.
+type resumeToken struct {
+	Name        string    `bson:"_id"`
+	Token       bson.Raw  `bson:"token"`
+	UpdatedDate time.Time `bson:"updatedDate"`
+}
+
+// NewMongoTokenStore creates a store keeping resume tokens in the given collection of the connection's database,
+// DefaultResumeTokenCollection when empty.
+func NewMongoTokenStore(conn *DBConnection, collection string) *MongoTokenStore {
+	if collection == "" {
+		collection = DefaultResumeTokenCollection
+	}
+	return &MongoTokenStore{conn: conn, collection: collection}
+}
+
+// Load returns the token saved under name, nil when there is none.
+func (m *MongoTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	var saved resumeToken
+	err := m.conn.Collection(m.collection).FindOne(m.conn.context(ctx), Q{"_id": name}).Decode(&saved)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return saved.Token, nil
+}
+
+// Save saves the token under name.
+func (m *MongoTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	saved := resumeToken{Name: name, Token: token, UpdatedDate: time.Now()}
+	_, err := m.conn.Collection(m.collection).ReplaceOne(m.conn.context(ctx), Q{"_id": name}, saved, options.Replace().SetUpsert(true))
+	return err
+}
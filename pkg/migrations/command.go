@@ -0,0 +1,194 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/phil-inc/pmongo/pkg/core"
+)
+
+// ErrUsage is matched by the errors Command returns for invalid arguments, after printing its usage.
+var ErrUsage = errors.New("invalid usage")
+
+const usage = `Usage: pmongo migrate [flags] <command> [argument]
+
+Commands:
+  up [version]   apply the pending migrations, up to version when given
+  down [steps]   roll back the last applied migrations, 1 by default
+  status         list the registered and applied migrations
+
+Flags:
+`
+
+// Command runs the migrate command on every database having registered migrations, or on the one selected with
+// -db. The databases are set up from the configs of the file given with -config, or from the environment
+// variables with the -env prefix, see core.LoadConfigsFromFile and core.LoadConfigsFromEnv. Output is written to
+// out.
+func Command(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		fmt.Fprint(out, usage)
+		flags.PrintDefaults()
+	}
+	configFile := flags.String("config", "", "YAML or JSON file of the database configs")
+	envPrefix := flags.String("env", "db", "prefix of the environment variables of the database configs, when -config is not set")
+	dbName := flags.String("db", "", "database to migrate, all the databases having registered migrations when empty")
+	dryRun := flags.Bool("dry-run", false, "list the migrations up or down would run, without running them")
+	lockTTL := flags.Duration("lock-ttl", DefaultLockTTL, "time after which the lock of an instance that stopped responding is taken over")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrUsage, err)
+	}
+
+	action, err := parseAction(flags.Args())
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	names := Databases()
+	if *dbName != "" {
+		names = []string{*dbName}
+	}
+	if len(names) == 0 {
+		return errors.New("no migrations are registered")
+	}
+	var configs []core.DBConfig
+	if *configFile != "" {
+		configs, err = core.LoadConfigsFromFile(*configFile)
+	} else {
+		configs, err = core.LoadConfigsFromEnv(*envPrefix)
+	}
+	if err != nil {
+		return err
+	}
+
+	registry := core.NewRegistry()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		registry.Shutdown(ctx)
+	}()
+	for _, name := range names {
+		config, ok := findConfig(configs, name)
+		if !ok {
+			return fmt.Errorf("no config for database %s", name)
+		}
+		if err := registry.Setup(config); err != nil {
+			return err
+		}
+		// Migrations always run on the primary, whatever the read preference of the config.
+		conn, err := registry.ConnectionWith(name, core.ReadPref{Mode: core.PrimaryMode})
+		if err != nil {
+			return err
+		}
+		migrator, err := ForDatabase(name, conn, Options{DryRun: *dryRun, LockTTL: *lockTTL})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s:\n", name)
+		if err := action(ctx, migrator, out); err != nil {
+			return fmt.Errorf("migrating %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// action runs a migrate command on one database.
+type action func(ctx context.Context, migrator *Migrator, out io.Writer) error
+
+// parseAction returns the action of the command line arguments left after the flags.
+func parseAction(args []string) (action, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("%w: expected a command and at most one argument", ErrUsage)
+	}
+	var argument int64
+	if len(args) == 2 {
+		var err error
+		if argument, err = strconv.ParseInt(args[1], 10, 64); err != nil || argument <= 0 {
+			return nil, fmt.Errorf("%w: invalid argument %q, expected a positive number", ErrUsage, args[1])
+		}
+	}
+
+	switch args[0] {
+	case "up":
+		return func(ctx context.Context, migrator *Migrator, out io.Writer) error {
+			applied, err := migrator.Up(ctx, argument)
+			printMigrations(out, migrator, "applied", applied)
+			return err
+		}, nil
+	case "down":
+		steps := 1
+		if argument > 0 {
+			steps = int(argument)
+		}
+		return func(ctx context.Context, migrator *Migrator, out io.Writer) error {
+			reverted, err := migrator.Down(ctx, steps)
+			printMigrations(out, migrator, "rolled back", reverted)
+			return err
+		}, nil
+	case "status":
+		if len(args) > 1 {
+			return nil, fmt.Errorf("%w: status takes no argument", ErrUsage)
+		}
+		return func(ctx context.Context, migrator *Migrator, out io.Writer) error {
+			statuses, err := migrator.Status(ctx)
+			if err != nil {
+				return err
+			}
+			printStatuses(out, statuses)
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown command %q", ErrUsage, args[0])
+}
+
+// findConfig returns the config of the database registered under the given name.
+func findConfig(configs []core.DBConfig, name string) (core.DBConfig, bool) {
+	for _, config := range configs {
+		if config.Name() == name {
+			return config, true
+		}
+	}
+	return core.DBConfig{}, false
+}
+
+// printMigrations lists the migrations that were run, or would be in dry-run mode.
+func printMigrations(out io.Writer, migrator *Migrator, done string, migrations []Migration) {
+	if migrator.opts.DryRun {
+		done = "would be " + done
+	}
+	if len(migrations) == 0 {
+		fmt.Fprintf(out, "  no migration %s\n", done)
+		return
+	}
+	for _, migration := range migrations {
+		fmt.Fprintf(out, "  %s %d %s\n", done, migration.Version, migration.Description)
+	}
+}
+
+// printStatuses writes the statuses as a table.
+func printStatuses(out io.Writer, statuses []Status) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  VERSION\tSTATE\tAPPLIED\tDESCRIPTION")
+	for _, status := range statuses {
+		state, applied := "pending", "-"
+		if status.Applied {
+			state, applied = "applied", status.AppliedDate.Format(time.RFC3339)
+		}
+		if !status.Registered {
+			state = "unregistered"
+		}
+		fmt.Fprintf(w, "  %d\t%s\t%s\t%s\n", status.Version, state, applied, status.Description)
+	}
+	w.Flush()
+}
@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/phil-inc/pmongo/pkg/core"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LockCollection holds the lock taken while migrating, one document per database.
+const LockCollection = "migrationLocks"
+
+// lockID is the _id of the lock document.
+const lockID = "migrations"
+
+// ErrLocked is matched by the error returned when another instance holds the migration lock.
+var ErrLocked = errors.New("migrations are locked")
+
+// lock is the lock document. The lock is free once ExpiresAt is past, so that an instance dying while migrating
+// does not block the others forever.
+type lock struct {
+	ID        string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+func (lock) CollectionName() string {
+	return LockCollection
+}
+
+// acquire takes the lock, or extends it when the owner already holds it. When another owner holds it, the
+// upsert conflicts with its document on _id.
+func (m *Migrator) acquire(ctx context.Context) error {
+	now := time.Now()
+	selector := core.Where("_id").Eq(lockID).And(core.Or(core.Where("expiresAt").Lt(now), core.Where("owner").Eq(m.opts.Owner)))
+	update := core.NewUpdate().Set("owner", m.opts.Owner).Set("expiresAt", now.Add(m.opts.LockTTL))
+	err := m.conn.FindOneAndUpdate(ctx, selector, update, &lock{}, core.FindOneAndOptions{Upsert: true, ReturnAfter: true})
+	if mongo.IsDuplicateKeyError(err) {
+		held := &lock{}
+		if err := m.conn.Find(ctx, core.Q{"_id": lockID}, held); err != nil {
+			return fmt.Errorf("%w by another instance", ErrLocked)
+		}
+		return fmt.Errorf("%w by %s until %s", ErrLocked, held.Owner, held.ExpiresAt.Format(time.RFC3339))
+	}
+	return err
+}
+
+// lock takes the lock and returns a context for the migrations along with the function releasing the lock.
+// Until released, the lock is extended every third of LockTTL, so that it does not expire while a long migration
+// runs. When another instance took it over meanwhile, e.g. after a pause longer than LockTTL, the context is
+// canceled with an error matching ErrLocked as its cause, see lockError.
+func (m *Migrator) lock(ctx context.Context) (context.Context, func(), error) {
+	if err := m.acquire(ctx); err != nil {
+		return nil, nil, err
+	}
+	locked, cancel := context.WithCancelCause(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(max(m.opts.LockTTL/3, time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-locked.Done():
+				return
+			case <-ticker.C:
+			}
+			err := m.acquire(locked)
+			if errors.Is(err, ErrLocked) {
+				m.conn.Logger().Error("Lost the migration lock, stopping", "db", m.conn.DB.Name(), "error", err)
+				cancel(fmt.Errorf("lost the migration lock: %w", err))
+				return
+			}
+			if err != nil && locked.Err() == nil {
+				// Retried on the next tick, the lock only expires after LockTTL.
+				m.conn.Logger().Warn("Error extending the migration lock", "db", m.conn.DB.Name(), "error", err)
+			}
+		}
+	}()
+
+	return locked, func() {
+		cancel(nil)
+		<-stopped
+		// Release the lock even when ctx is done, so that others do not wait for it to expire.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		query := core.Where("_id").Eq(lockID).And(core.Where("owner").Eq(m.opts.Owner))
+		if err := m.conn.RemoveAll(ctx, query, &lock{}); err != nil {
+			m.conn.Logger().Warn("Error releasing the migration lock", "db", m.conn.DB.Name(), "error", err)
+		}
+	}, nil
+}
+
+// lockError returns the reason the context returned by lock was canceled when the lock was lost, as it explains
+// err, the error of a migration interrupted by the cancellation.
+func lockError(locked context.Context, err error) error {
+	if cause := context.Cause(locked); errors.Is(cause, ErrLocked) {
+		return cause
+	}
+	return err
+}
@@ -0,0 +1,354 @@
+// Package migrations runs versioned data migrations on top of pmongo connections. Migrations are Go functions
+// registered per database, typically from init functions:
+//
+//	func init() {
+//		migrations.Register("main", migrations.Migration{
+//			Version:     20240501,
+//			Description: "backfill order status",
+//			Up: func(ctx context.Context, conn *core.DBConnection) error {
+//				_, err := conn.UpdateMany(ctx, core.Where("status").Exists(false),
+//					core.NewUpdate().Set("status", "active"), &Order{})
+//				return err
+//			},
+//		})
+//	}
+//
+// A Migrator applies the pending migrations in version order and records each one in the migrations collection,
+// holding a lock in the database so that only one instance migrates at a time. Command runs the migrate command
+// of the pmongo binary.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/phil-inc/pmongo/pkg/core"
+)
+
+// HistoryCollection holds a Record for every applied migration.
+const HistoryCollection = "migrations"
+
+// DefaultLockTTL is how long the migration lock is held without being refreshed before another instance may
+// take it over. A migrating instance refreshes it every third of the TTL.
+const DefaultLockTTL = 10 * time.Minute
+
+// ErrIrreversible is returned when rolling back a migration without Down.
+var ErrIrreversible = errors.New("migration cannot be rolled back")
+
+// ErrUnknownMigration is returned when rolling back an applied migration that is not registered.
+var ErrUnknownMigration = errors.New("unknown migration")
+
+// Migration is a versioned change of the data of a database. Versions are positive and unique per database;
+// dates such as 20240501 keep them ordered across branches. Down reverts Up, and may be nil when the migration
+// cannot be rolled back.
+//
+// Migrations should be idempotent: a migration failing half way is not recorded and runs again in full. With
+// Transactional, Up or Down and the history record run in one transaction, which requires a replica set.
+type Migration struct {
+	Version       int64
+	Description   string
+	Up            func(ctx context.Context, conn *core.DBConnection) error
+	Down          func(ctx context.Context, conn *core.DBConnection) error
+	Transactional bool
+}
+
+// Record is the history entry of an applied migration.
+type Record struct {
+	Version     int64     `json:"version" bson:"_id"`
+	Description string    `json:"description" bson:"description"`
+	AppliedDate time.Time `json:"appliedDate" bson:"appliedDate"`
+	DurationMs  int64     `json:"durationMs" bson:"durationMs"`
+}
+
+// CollectionName returns HistoryCollection.
+func (Record) CollectionName() string {
+	return HistoryCollection
+}
+
+// Status is the state of a migration: registered, applied or both. Migrations applied but no longer
+// registered have no Up or Down and can only be seen, not rolled back.
+type Status struct {
+	Version     int64
+	Description string
+	Registered  bool
+	Applied     bool
+	AppliedDate time.Time
+}
+
+var (
+	registryMu sync.RWMutex
+	registered = make(map[string][]Migration)
+)
+
+// Register adds migrations for the database registered under dbName in the core registry. It panics when a
+// migration has no Up, a version that is not positive or one already registered for the database, as these are
+// programming errors.
+func Register(dbName string, migrations ...Migration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	all := append(append([]Migration(nil), registered[dbName]...), migrations...)
+	if err := validate(all); err != nil {
+		panic(fmt.Sprintf("migrations: registering for %s: %s", dbName, err))
+	}
+	registered[dbName] = all
+}
+
+// Registered returns the migrations registered for the database, sorted by version.
+func Registered(dbName string) []Migration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sorted(registered[dbName])
+}
+
+// Databases returns the names of the databases having registered migrations, sorted.
+func Databases() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registered))
+	for name := range registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate checks that the migrations have an Up and positive, unique versions.
+func validate(migrations []Migration) error {
+	versions := make(map[int64]bool, len(migrations))
+	for _, migration := range migrations {
+		switch {
+		case migration.Version <= 0:
+			return fmt.Errorf("migration %q has version %d, expected a positive version", migration.Description, migration.Version)
+		case migration.Up == nil:
+			return fmt.Errorf("migration %d has no Up", migration.Version)
+		case versions[migration.Version]:
+			return fmt.Errorf("migration %d is registered twice", migration.Version)
+		}
+		versions[migration.Version] = true
+	}
+	return nil
+}
+
+// sorted returns a copy of the migrations sorted by version.
+func sorted(migrations []Migration) []Migration {
+	result := append([]Migration(nil), migrations...)
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result
+}
+
+// Options are the options of a Migrator. With DryRun, Up and Down return the migrations they would run without
+// running them nor taking the lock. Owner identifies the instance holding the lock, the host name and process
+// id by default, and LockTTL defaults to DefaultLockTTL.
+type Options struct {
+	DryRun  bool
+	Owner   string
+	LockTTL time.Duration
+}
+
+// Migrator applies and rolls back the migrations of one database.
+type Migrator struct {
+	conn       *core.DBConnection
+	migrations []Migration
+	opts       Options
+}
+
+// New returns a Migrator running the given migrations on the connection, or an error when they are invalid, see
+// Register.
+func New(conn *core.DBConnection, migrations []Migration, opts Options) (*Migrator, error) {
+	if err := validate(migrations); err != nil {
+		return nil, err
+	}
+	if opts.Owner == "" {
+		host, _ := os.Hostname()
+		opts.Owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = DefaultLockTTL
+	}
+	return &Migrator{conn: conn, migrations: sorted(migrations), opts: opts}, nil
+}
+
+// ForDatabase returns a Migrator running the migrations registered for dbName on the connection.
+func ForDatabase(dbName string, conn *core.DBConnection, opts Options) (*Migrator, error) {
+	return New(conn, Registered(dbName), opts)
+}
+
+// history returns the records of the applied migrations, sorted by version.
+func (m *Migrator) history(ctx context.Context) ([]*Record, error) {
+	records, err := core.NewRepository[*Record](m.conn).FindAll(ctx, core.Q{})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	return records, nil
+}
+
+// Status returns the state of the registered and applied migrations, sorted by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	records, err := m.history(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[int64]*Status, len(m.migrations)+len(records))
+	for _, migration := range m.migrations {
+		statuses[migration.Version] = &Status{Version: migration.Version, Description: migration.Description, Registered: true}
+	}
+	for _, record := range records {
+		status, ok := statuses[record.Version]
+		if !ok {
+			status = &Status{Version: record.Version, Description: record.Description}
+			statuses[record.Version] = status
+		}
+		status.Applied = true
+		status.AppliedDate = record.AppliedDate
+	}
+
+	result := make([]Status, 0, len(statuses))
+	for _, status := range statuses {
+		result = append(result, *status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// pending returns the registered migrations that are not applied, up to the target version unless it is 0.
+func (m *Migrator) pending(ctx context.Context, target int64) ([]Migration, error) {
+	records, err := m.history(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]bool, len(records))
+	for _, record := range records {
+		applied[record.Version] = true
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] && (target == 0 || migration.Version <= target) {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations in version order, up to the target version or all of them when it is 0,
+// and returns those it applied. Migrations older than the last applied one, e.g. merged from another branch,
+// are applied too. It stops at the first failing migration, returning the error with the migrations applied
+// before it. Up returns an error matching ErrLocked when another instance is migrating, or took the lock over
+// while it was migrating, in which case the context of the running migration is canceled.
+func (m *Migrator) Up(ctx context.Context, target int64) ([]Migration, error) {
+	if m.opts.DryRun {
+		return m.pending(ctx, target)
+	}
+	locked, release, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Read the history once locked, as another instance may have just migrated.
+	pending, err := m.pending(locked, target)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, migration := range pending {
+		if err := m.run(locked, migration, true); err != nil {
+			return applied, lockError(locked, err)
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// Down rolls back the given number of most recently applied migrations, in reverse version order, and returns
+// those it rolled back. Nothing is rolled back when one of them is not registered or has no Down.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if m.opts.DryRun {
+		return m.rollbacks(ctx, steps)
+	}
+	locked, release, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rollbacks, err := m.rollbacks(locked, steps)
+	if err != nil {
+		return nil, err
+	}
+	var reverted []Migration
+	for _, migration := range rollbacks {
+		if err := m.run(locked, migration, false); err != nil {
+			return reverted, lockError(locked, err)
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// rollbacks returns the migrations Down rolls back, checking that they can be.
+func (m *Migrator) rollbacks(ctx context.Context, steps int) ([]Migration, error) {
+	records, err := m.history(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+	var rollbacks []Migration
+	for i := len(records) - 1; i >= 0 && len(rollbacks) < steps; i-- {
+		migration, ok := byVersion[records[i].Version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d (%s) is applied but not registered", ErrUnknownMigration, records[i].Version, records[i].Description)
+		}
+		if migration.Down == nil {
+			return nil, fmt.Errorf("%w: %d (%s) has no Down", ErrIrreversible, migration.Version, migration.Description)
+		}
+		rollbacks = append(rollbacks, migration)
+	}
+	return rollbacks, nil
+}
+
+// run applies the migration, or rolls it back, and updates the history, in a transaction when the migration is
+// transactional.
+func (m *Migrator) run(ctx context.Context, migration Migration, up bool) error {
+	logger := m.conn.Logger()
+	direction := "Applying"
+	if !up {
+		direction = "Rolling back"
+	}
+	logger.Info(direction+" migration", "db", m.conn.DB.Name(), "version", migration.Version, "description", migration.Description)
+
+	start := time.Now()
+	step := func(conn *core.DBConnection) error {
+		if !up {
+			if err := migration.Down(ctx, conn); err != nil {
+				return err
+			}
+			return conn.Remove(ctx, core.Q{"_id": migration.Version}, &Record{})
+		}
+		if err := migration.Up(ctx, conn); err != nil {
+			return err
+		}
+		return conn.Save(ctx, &Record{Version: migration.Version, Description: migration.Description,
+			AppliedDate: time.Now().UTC(), DurationMs: time.Since(start).Milliseconds()})
+	}
+	var err error
+	if migration.Transactional {
+		err = m.conn.WithTransaction(ctx, step)
+	} else {
+		err = step(m.conn)
+	}
+	if err != nil {
+		logger.Error("Migration failed", "db", m.conn.DB.Name(), "version", migration.Version, "error", err)
+		return fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+	}
+	logger.Info("Migration done", "db", m.conn.DB.Name(), "version", migration.Version, "duration", time.Since(start))
+	return nil
+}
@@ -0,0 +1,43 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPmongoGen(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "fields.go")
+	out, err := exec.Command("go", "run", "../cmd/pmongo-gen", "-dir", "testdata/models", "-output", output, "-type", "Order").CombinedOutput()
+	assert.Nil(t, err, string(out))
+
+	src, err := os.ReadFile(output)
+	assert.Nil(t, err)
+	assert.Equal(t, `// Code generated by pmongo-gen. DO NOT EDIT.
+
+package models
+
+// OrderField is a field path of Order.
+type OrderField string
+
+// Field paths of Order.
+const (
+	OrderID          OrderField = "_id"
+	OrderCreatedDate OrderField = "createdDate"
+	OrderUpdatedDate OrderField = "updatedDate"
+	OrderStatus      OrderField = "status"
+	OrderAddress     OrderField = "address"
+	OrderAddressCity OrderField = "address.city"
+	OrderAddressZip  OrderField = "address.zip"
+	OrderItems       OrderField = "items"
+	OrderItemsSku    OrderField = "items.sku"
+	OrderItemsQty    OrderField = "items.qty"
+	OrderShippedAt   OrderField = "shippedAt"
+	OrderAudit       OrderField = "audit"
+	OrderAuditBy     OrderField = "audit.by"
+)
+`, string(src))
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/phil-inc/pmongo/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// orderField is a field path type as generated by pmongo-gen.
+type orderField string
+
+func TestQueryBuilderTypedFields(t *testing.T) {
+	const orderStatus orderField = "status"
+	assert.Equal(t, core.Q{"status": "active"}, core.Where(orderStatus).Eq("active"))
+	assert.Equal(t, core.SortField{Field: "status", Descending: true}, core.Desc(orderStatus))
+	assert.Equal(t, orderField("status.$[s]"), core.FilteredPositional(orderStatus, "s"))
+
+	update := core.NewUpdateOf[orderField]().Set(orderStatus, "shipped").Set(core.Positional(orderStatus)+".at", 1).Unset("notes")
+	assert.Equal(t, core.Q{"$set": core.Q{"status": "shipped", "status.$.at": 1}, "$unset": core.Q{"notes": ""}}, update.Q())
+}
+
+func TestQueryBuilder(t *testing.T) {
+	query := core.Where("status").Eq("active").
+		And(core.Where("age").Gt(18)).
+		And(core.Where("name").Regex("^jo", "i"))
+	assert.Equal(t, bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "status", Value: "active"}},
+		bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 18}}}},
+		bson.D{{Key: "name", Value: bson.D{{Key: "$regex", Value: primitive.Regex{Pattern: "^jo", Options: "i"}}}}},
+	}}}, query.D())
+
+	query = core.Where("roles").All("admin", "ops").Or(core.Where("deleted").Exists(false))
+	assert.Equal(t, core.Q{"$or": []core.Q{
+		{"roles": core.Q{"$all": []interface{}{"admin", "ops"}}},
+		{"deleted": core.Q{"$exists": false}},
+	}}, query)
+
+	assert.Equal(t, core.Q{"age": core.Q{"$not": core.Q{"$gte": 18, "$lte": 65}}}, core.Where("age").Not().Between(18, 65))
+	assert.Equal(t, core.Q{"status": core.Q{"$not": core.Q{"$eq": "x"}}}, core.Where("status").Not().Eq("x"))
+	assert.Equal(t, core.Q{"tags": core.Q{"$elemMatch": core.Q{"$gt": 1, "$lt": 5}}},
+		core.Where("tags").ElemMatch(core.Where("").Gt(1), core.Where("").Lt(5)))
+	assert.Equal(t, core.Q{"items": core.Q{"$elemMatch": core.Q{"qty": core.Q{"$gt": 1, "$lt": 5}, "sku": "a"}}},
+		core.Where("items").ElemMatch(core.Where("qty").Gt(1), core.Where("qty").Lt(5), core.Where("sku").Eq("a")))
+	assert.Equal(t, core.Q{"items": core.Q{"$elemMatch": core.Q{"$and": []core.Q{{"qty": 1}, {"qty": core.Q{"$lt": 5}}}}}},
+		core.Where("items").ElemMatch(core.Where("qty").Eq(1), core.Where("qty").Lt(5)))
+	assert.Equal(t, core.Q{"status": "active"}, core.And(core.Q{}, core.Where("status").Eq("active")))
+	assert.Equal(t, core.Q{"$expr": false}, core.Or())
+	assert.Equal(t, core.Q{}, core.And(core.Q{}, core.Q{}))
+	assert.Equal(t, core.Q{}, core.Nor())
+	assert.Equal(t, core.Q{"$or": []core.Q{{}, {"status": "active"}}}, core.Or(core.Q{}, core.Where("status").Eq("active")))
+	assert.Equal(t, core.Q{}, core.Or(core.Q{}))
+	assert.Equal(t, core.Q{"$nor": []core.Q{{"a": 1}}}, core.Nor(core.Where("a").Eq(1)))
+	assert.Equal(t, core.Q{"$expr": core.Q{"$gt": []interface{}{"$spent", "$budget"}}},
+		core.Expr(core.Q{"$gt": []interface{}{"$spent", "$budget"}}))
+}
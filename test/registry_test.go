@@ -0,0 +1,46 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/phil-inc/pmongo/pkg/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryConcurrentRegisterAndLookup(t *testing.T) {
+	registry := core.NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("db-%d", i)
+			registry.Register(core.Db{Config: core.DBConfig{DBName: name}})
+			_, ok := registry.Get(name)
+			assert.True(t, ok)
+			registry.Names()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 50, registry.Len())
+
+	db, ok := registry.Remove("db-0")
+	assert.True(t, ok)
+	assert.Equal(t, "db-0", db.Config.DBName)
+	_, ok = registry.Get("db-0")
+	assert.False(t, ok)
+	assert.Equal(t, 49, registry.Len())
+}
+
+func TestRegistryIsolation(t *testing.T) {
+	first := core.NewRegistry()
+	second := core.NewRegistry()
+	first.Register(core.Db{Config: core.DBConfig{DBName: "root-db"}})
+
+	_, ok := second.Get("root-db")
+	assert.False(t, ok)
+	assert.Nil(t, second.Connection())
+}
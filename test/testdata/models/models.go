@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/phil-inc/pmongo/pkg/core"
+)
+
+//go:generate go run github.com/phil-inc/pmongo/cmd/pmongo-gen -type Order
+
+type Order struct {
+	core.BaseData `bson:",inline"`
+	Status        string            `bson:"status"`
+	Address       *Address          `bson:"address,omitempty"`
+	Items         []Item            `bson:"items"`
+	ShippedAt     time.Time         `bson:"shippedAt"`
+	Note          string            `bson:"-"`
+	Extra         map[string]string `bson:",inline"`
+	Audit
+	internal string
+}
+
+func (Order) CollectionName() string {
+	return "orders"
+}
+
+type Address struct {
+	City string `bson:"city"`
+	Zip  string
+}
+
+type Item struct {
+	Sku string `bson:"sku"`
+	Qty int    `bson:"qty"`
+}
+
+type Audit struct {
+	By string `bson:"by"`
+}